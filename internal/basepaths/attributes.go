@@ -0,0 +1,75 @@
+package basepaths
+
+import (
+	"strings"
+)
+
+// Linguist uses these attributes to mark code that isn't really part of the
+// repo, so there's no point in tidying or linting it.
+var linguistAttributes = []string{"linguist-generated", "linguist-vendored"}
+
+func (bf *BasePaths) applyAttributes(paths []string) []string {
+	filtered := []string{}
+	for _, p := range paths {
+		reason, filters := attributeExcludes(bf.attrs.Attributes(p))
+		if reason != "" {
+			bf.l.Debugf("Excluding %s because %s", p, reason)
+			continue
+		}
+		if len(filters) != 0 {
+			bf.attrExcludes[p] = filters
+		}
+		filtered = append(filtered, p)
+	}
+
+	return filtered
+}
+
+// attributeExcludes returns the reason a file is excluded from every filter
+// because of its attributes, or the names of the filters it is excluded
+// from. Setting the precious attribute ("precious" or "precious=true")
+// overrides the other attributes, and unsetting it ("-precious" or
+// "precious=false") excludes the file from everything. Otherwise its value
+// is a comma-separated list of filters to exclude the file from, like
+// "precious=-gofmt,-golint".
+func attributeExcludes(attrs map[string]string) (string, []string) {
+	filters := []string{}
+	switch v := attrs["precious"]; v {
+	case "true":
+		return "", nil
+	case "false":
+		return "its precious attribute is unset", nil
+	case "":
+	default:
+		for _, f := range strings.Split(v, ",") {
+			if strings.HasPrefix(f, "-") && len(f) > 1 {
+				filters = append(filters, f[1:])
+			}
+		}
+	}
+
+	for _, a := range linguistAttributes {
+		if isTrue(attrs[a]) {
+			return "it has the " + a + " attribute", nil
+		}
+	}
+	if attrs["diff"] == "false" {
+		return "it has the -diff attribute", nil
+	}
+
+	return "", filters
+}
+
+// Linguist accepts "true" or "1" as well as simply setting the attribute.
+func isTrue(v string) bool {
+	return v == "true" || v == "1"
+}
+
+func contains(vals []string, v string) bool {
+	for _, s := range vals {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
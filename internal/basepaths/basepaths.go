@@ -7,8 +7,12 @@ import (
 	"sort"
 
 	alog "github.com/apex/log"
+	"github.com/houseabsolute/precious/internal/filetype"
+	"github.com/houseabsolute/precious/internal/gitattributes"
+	"github.com/houseabsolute/precious/internal/gitignore"
+	"github.com/houseabsolute/precious/internal/gitrepo"
 	"github.com/houseabsolute/precious/internal/pathfilter"
-	"github.com/mattn/go-zglob/fastwalk"
+	"github.com/houseabsolute/precious/internal/skip"
 	"github.com/pkg/errors"
 )
 
@@ -19,31 +23,103 @@ const (
 	AllFiles
 	GitModified
 	GitStaged
+	// GitBase finds the files that changed since the merge base of HEAD
+	// and the ref passed to SetBase.
+	GitBase
+	// FromFile reads the paths from the file passed to SetFilesFrom.
+	FromFile
+	// GitPrePush finds the files changed in the commits that are being
+	// pushed, according to the refs that git passes to a pre-push hook on
+	// stdin.
+	GitPrePush
 )
 
+// StdinDirPrefix is the prefix of the temp dirs that the stdin package
+// creates next to the files whose content is read from stdin. Another
+// precious process may be running on stdin in the same tree, so we always
+// exclude these.
+const StdinDirPrefix = ".precious-stdin-"
+
 type BasePaths struct {
 	l         *alog.Logger
 	mode      Mode
+	root      string
 	cliPaths  []string
+	baseRef   string
+	filesFrom string
 	basePaths *[]string
 	filter    *pathfilter.Filter
+	ignore    *gitignore.Matcher
+	attrs     *gitattributes.Matcher
+	// If this is true, the git diff modes include changes that are only in
+	// the working tree and untracked files. This is always true for the
+	// GitModified mode.
+	includeWorktree bool
+	// If this is true, paths inside submodules are included.
+	recurseSubmodules bool
+	// If this is true, the paths read by the FromFile mode are separated by
+	// NUL bytes instead of newlines.
+	nulSeparated bool
+	// This is set the first time it's needed by the GitBase mode.
+	mergeBaseSHA string
+	// This maps paths to the names of filters that their precious attribute
+	// excludes them from.
+	attrExcludes map[string][]string
 }
 
-func New(l *alog.Logger, m Mode, cliPaths, exclude, ignoreFiles []string) (*BasePaths, error) {
+// New returns a BasePaths for the given mode. Paths are ignored according to
+// the given ignore files, the git excludes for the checkout at root, and any
+// .gitignore files found between the root and the paths. The exclude entries
+// may refer to types in the given registry. Paths are also excluded
+// according to their git attributes.
+func New(l *alog.Logger, m Mode, root string, types *filetype.Registry, cliPaths, exclude, ignoreFiles []string) (*BasePaths, error) {
 	if m != FromCLI && len(cliPaths) != 0 {
-		return nil, errors.New("You cannot provide paths on the command line along with the -a, -g, or -s flags")
+		return nil, errors.New("You cannot provide paths on the command line along with the -a, -g, -s, --base, --files-from, or --pre-push flags")
+	}
+
+	exclude = append(append([]string{}, exclude...), "**/"+StdinDirPrefix+"*/**/*")
+
+	filter, err := pathfilter.New(root, types, []string{}, []string{}, exclude, []string{}, skip.Rules{})
+	if err != nil {
+		return nil, err
 	}
 
-	filter, err := pathfilter.New([]string{}, exclude, ignoreFiles)
+	ignore, err := gitignore.New(root)
+	if err != nil {
+		return nil, err
+	}
+	err = ignore.AddGitExcludes()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range ignoreFiles {
+		err = ignore.AddFile(f)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Could not compile gitignore style file at %s", f))
+		}
+	}
+
+	attrs, err := gitattributes.New(root)
+	if err != nil {
+		return nil, err
+	}
+	err = attrs.AddGitAttributes()
 	if err != nil {
 		return nil, err
 	}
 
 	return &BasePaths{
-		l:        l,
-		mode:     m,
-		cliPaths: cliPaths,
-		filter:   filter,
+		l:            l,
+		mode:         m,
+		root:         root,
+		cliPaths:     cliPaths,
+		filter:       filter,
+		ignore:       ignore,
+		attrs:        attrs,
+		attrExcludes: map[string][]string{},
+		// -g looks at everything that differs from HEAD, while -s only
+		// looks at what is in the index.
+		includeWorktree: m == GitModified,
 	}, nil
 }
 
@@ -64,6 +140,15 @@ func (bf *BasePaths) Paths() ([]string, error) {
 			return []string{}, errors.Wrap(err, fmt.Sprintf("Could not stat path %s", p))
 		}
 
+		err = bf.ignore.LoadParents(p)
+		if err != nil {
+			return []string{}, err
+		}
+		err = bf.attrs.LoadParents(p)
+		if err != nil {
+			return []string{}, err
+		}
+
 		if fi.IsDir() {
 			found, err := bf.searchDir(p)
 			if err != nil {
@@ -74,6 +159,10 @@ func (bf *BasePaths) Paths() ([]string, error) {
 			continue
 		}
 
+		if bf.ignore.Ignored(p, false) {
+			bf.l.Debugf("Ignoring %s", p)
+			continue
+		}
 		paths = append(paths, p)
 	}
 
@@ -81,6 +170,7 @@ func (bf *BasePaths) Paths() ([]string, error) {
 	if err != nil {
 		return []string{}, err
 	}
+	paths = bf.applyAttributes(paths)
 
 	sort.Strings(paths)
 	bf.basePaths = &paths
@@ -88,16 +178,93 @@ func (bf *BasePaths) Paths() ([]string, error) {
 	return *bf.basePaths, nil
 }
 
+// PathsFor returns the paths for the named filter. This is the same as
+// Paths, except that paths whose precious attribute excludes them from the
+// filter are removed.
+func (bf *BasePaths) PathsFor(name string) ([]string, error) {
+	paths, err := bf.Paths()
+	if err != nil {
+		return []string{}, err
+	}
+
+	filtered := []string{}
+	for _, p := range paths {
+		if contains(bf.attrExcludes[p], name) {
+			bf.l.Debugf("Excluding %s from the %s filter because of its precious attribute", p, name)
+			continue
+		}
+		filtered = append(filtered, p)
+	}
+
+	return filtered, nil
+}
+
+// Explain returns the reason the path is never filtered because of the
+// global ignore and exclude rules or its git attributes, or an empty string
+// if it can be filtered.
+func (bf *BasePaths) Explain(path string) (string, error) {
+	return bf.ExplainAs(path, path)
+}
+
+// ExplainAs is like Explain, except that the path's content is at
+// contentPath, which is used for content read from stdin. The path itself
+// does not need to exist.
+func (bf *BasePaths) ExplainAs(path, contentPath string) (string, error) {
+	err := bf.ignore.LoadParents(path)
+	if err != nil {
+		return "", err
+	}
+	err = bf.attrs.LoadParents(path)
+	if err != nil {
+		return "", err
+	}
+
+	fi, err := os.Stat(contentPath)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("Could not stat path %s", contentPath))
+	}
+	if bf.ignore.Ignored(path, fi.IsDir()) {
+		return "it is ignored by git or a global ignore file", nil
+	}
+
+	reason, err := bf.filter.ExcludeReasonAs(path, contentPath)
+	if err != nil || reason != "" {
+		return reason, err
+	}
+
+	if fi.IsDir() {
+		return "", nil
+	}
+	reason, _ = attributeExcludes(bf.attrs.Attributes(path))
+	return reason, nil
+}
+
+// ExplainFilter returns the reason the path's git attributes exclude it from
+// the named filter, or an empty string if they don't.
+func (bf *BasePaths) ExplainFilter(path, name string) string {
+	_, filters := attributeExcludes(bf.attrs.Attributes(path))
+	if contains(filters, name) {
+		return fmt.Sprintf("its precious attribute excludes it from the %s filter", name)
+	}
+	return ""
+}
+
 func (bf *BasePaths) startingPaths() ([]string, error) {
 	if len(bf.cliPaths) > 0 {
 		bf.l.Debugf("Using explicit list of starting paths: %s", bf.cliPaths)
 		return bf.cliPaths, nil
 	} else if bf.mode == GitModified {
 		bf.l.Info("Using git modified paths as starting paths")
-		return nil, nil
+		return bf.gitDiffPaths()
 	} else if bf.mode == GitStaged {
 		bf.l.Info("Using git staged paths as starting paths")
-		return nil, nil
+		return bf.gitDiffPaths()
+	} else if bf.mode == GitBase {
+		return bf.gitDiffPaths()
+	} else if bf.mode == FromFile {
+		return bf.pathsFromFile()
+	} else if bf.mode == GitPrePush {
+		return bf.prePushPaths()
 	}
 
 	wd, err := os.Getwd()
@@ -108,18 +275,46 @@ func (bf *BasePaths) startingPaths() ([]string, error) {
 	return []string{wd}, nil
 }
 
+// We load each directory's .gitignore before looking at its contents, and we
+// don't descend into ignored or excluded directories at all. Like git, we
+// never look inside a .git directory, and we don't descend into submodules or
+// other nested checkouts unless --recurse-submodules was given.
 func (bf *BasePaths) searchDir(dir string) ([]string, error) {
 	paths := []string{}
-	err := fastwalk.FastWalk(dir, func(path string, typ os.FileMode) error {
-		filtered, err := bf.filter.ApplyExcludeRules([]string{path})
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		paths = append(paths, filtered...)
 
-		if len(paths) == 0 && typ.IsDir() {
-			return filepath.SkipDir
+		if info.IsDir() {
+			if path != dir {
+				if info.Name() == ".git" || bf.ignore.Ignored(path, true) {
+					return filepath.SkipDir
+				}
+				if !bf.recurseSubmodules && gitrepo.IsRoot(path) {
+					bf.l.Debugf("Skipping the nested checkout at %s", path)
+					return filepath.SkipDir
+				}
+				excluded, err := bf.filter.ApplyExcludeRules([]string{path})
+				if err != nil {
+					return err
+				}
+				if len(excluded) == 0 {
+					return filepath.SkipDir
+				}
+			}
+			err = bf.ignore.LoadDir(path)
+			if err != nil {
+				return err
+			}
+			return bf.attrs.LoadDir(path)
 		}
+
+		if bf.ignore.Ignored(path, false) {
+			return nil
+		}
+		paths = append(paths, path)
+
 		return nil
 	})
 
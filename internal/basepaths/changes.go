@@ -0,0 +1,171 @@
+package basepaths
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// LineRange is an inclusive range of line numbers.
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// Changes maps absolute paths to the lines in them that were added or
+// modified.
+type Changes map[string][]LineRange
+
+// Contains returns true if the line is within margin lines of a change to
+// the path.
+func (c Changes) Contains(path string, line, margin int) bool {
+	for _, r := range c[path] {
+		if line >= r.Start-margin && line <= r.End+margin {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangedLines returns the lines that were added or modified according to
+// git. This only works for the git modes, since the other modes don't have a
+// diff to look at.
+func (bf *BasePaths) ChangedLines() (Changes, error) {
+	if !bf.IsDiff() {
+		return nil, errors.New("Only the -g, -s, and --base flags have a diff to find changed lines in")
+	}
+
+	diffs, err := bf.gitDiffs()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := Changes{}
+	for _, d := range diffs {
+		err := d.addChangedLines(changes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+func (d repoDiff) addChangedLines(changes Changes) error {
+	// Every line in a new submodule is new.
+	if d.revs == nil {
+		for _, p := range d.paths {
+			changes[p] = []LineRange{{1, math.MaxInt32}}
+		}
+		return nil
+	}
+
+	args := append([]string{"diff", "-U0", "--no-color", "--no-ext-diff", "--no-renames", "--diff-filter=d", "--src-prefix=a/", "--dst-prefix=b/"}, d.revs...)
+	out, err := runGit(d.top, args...)
+	if err != nil {
+		return err
+	}
+
+	err = parseDiff(d.top, out, changes)
+	if err != nil {
+		return err
+	}
+
+	// Untracked files aren't in the diff, but every line in them is new.
+	if d.untracked {
+		untracked, err := untrackedPaths(d.top)
+		if err != nil {
+			return err
+		}
+		for _, p := range absPaths(d.top, untracked) {
+			changes[p] = []LineRange{{1, math.MaxInt32}}
+		}
+	}
+
+	return nil
+}
+
+// IsDiff returns true if the mode finds paths by looking at a git diff.
+func (bf *BasePaths) IsDiff() bool {
+	return bf.mode == GitModified || bf.mode == GitStaged || bf.mode == GitBase
+}
+
+var hunkRE = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// With -U0 each hunk header gives the exact lines that were added in the new
+// file, and we add them to the changes. A hunk that only removes lines has a
+// count of 0, and there's no line in the new file to report an issue on. We
+// skip over the hunk's body using the counts in its header, since an added
+// line like "++ x" looks just like the "+++ " header of the next file.
+func parseDiff(top, diff string, changes Changes) error {
+	path := ""
+	body := 0
+	for _, l := range strings.Split(diff, "\n") {
+		if body > 0 {
+			// The "\ No newline at end of file" marker is not part of the
+			// counts.
+			if !strings.HasPrefix(l, "\\") {
+				body--
+			}
+			continue
+		}
+
+		if strings.HasPrefix(l, "+++ ") {
+			path = ""
+			if name := strings.TrimSuffix(strings.TrimPrefix(l, "+++ "), "\t"); name != "/dev/null" {
+				path = absPaths(top, []string{unquote(strings.TrimPrefix(name, "b/"))})[0]
+			}
+			continue
+		}
+
+		m := hunkRE.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+
+		removed, err := hunkCount(m[1])
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Could not parse the diff hunk header %q", l))
+		}
+		start, err := strconv.Atoi(m[2])
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Could not parse the diff hunk header %q", l))
+		}
+		count, err := hunkCount(m[3])
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Could not parse the diff hunk header %q", l))
+		}
+		body = removed + count
+
+		if count == 0 || path == "" {
+			continue
+		}
+
+		changes[path] = append(changes[path], LineRange{start, start + count - 1})
+	}
+
+	return nil
+}
+
+// A count that is left out of a hunk header is 1.
+func hunkCount(s string) (int, error) {
+	if s == "" {
+		return 1, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// Git quotes paths with unusual characters like a C string.
+func unquote(name string) string {
+	if !strings.HasPrefix(name, `"`) {
+		return name
+	}
+	if u, err := strconv.Unquote(name); err == nil {
+		return strings.TrimPrefix(u, "b/")
+	}
+	return name
+}
@@ -0,0 +1,141 @@
+package basepaths
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		want Changes
+	}{
+		{
+			name: "added and modified lines",
+			diff: `diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -3,2 +3,3 @@ func a() {
+-	x := 1
+-	y := 2
++	x := 10
++	y := 20
++	z := 30
+@@ -10 +11 @@ func b() {
+-	return
++	return nil
+`,
+			want: Changes{"/top/a.go": {{3, 5}, {11, 11}}},
+		},
+		{
+			name: "zero length hunks",
+			diff: `diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -4,2 +3,0 @@ func a() {
+-	x := 1
+-	y := 2
+@@ -8,0 +7,2 @@ func b() {
++	z := 3
++	w := 4
+`,
+			want: Changes{"/top/a.go": {{7, 8}}},
+		},
+		{
+			name: "new file",
+			diff: `diff --git a/sub/new.go b/sub/new.go
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/sub/new.go
+@@ -0,0 +1,2 @@
++package sub
++
+`,
+			want: Changes{"/top/sub/new.go": {{1, 2}}},
+		},
+		{
+			name: "rename",
+			diff: `diff --git a/old.go b/new.go
+similarity index 90%
+rename from old.go
+rename to new.go
+index 1111111..2222222 100644
+--- a/old.go
++++ b/new.go
+@@ -2 +2 @@
+-var x = 1
++var x = 2
+`,
+			want: Changes{"/top/new.go": {{2, 2}}},
+		},
+		{
+			name: "no newline at end of file",
+			diff: `diff --git a/a.txt b/a.txt
+index 1111111..2222222 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1 +1,2 @@
+-last
+\ No newline at end of file
++last
++more
+\ No newline at end of file
+diff --git a/b.txt b/b.txt
+index 1111111..2222222 100644
+--- a/b.txt
++++ b/b.txt
+@@ -5,0 +6 @@
++x
+`,
+			want: Changes{
+				"/top/a.txt": {{1, 2}},
+				"/top/b.txt": {{6, 6}},
+			},
+		},
+		{
+			name: "quoted paths",
+			diff: `diff --git "a/sp ace\303\251.txt" "b/sp ace\303\251.txt"
+index 1111111..2222222 100644
+--- "a/sp ace\303\251.txt"
++++ "b/sp ace\303\251.txt"
+@@ -1 +1 @@
+-a
++b
+`,
+			want: Changes{"/top/sp aceé.txt": {{1, 1}}},
+		},
+		{
+			name: "added lines that look like headers",
+			diff: `diff --git a/a.txt b/a.txt
+index 1111111..2222222 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1 +1,2 @@
+--- x
++++ y
++z
+@@ -5 +6 @@
+-a
++b
+`,
+			want: Changes{"/top/a.txt": {{1, 2}, {6, 6}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Changes{}
+			err := parseDiff("/top", test.diff, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseDiff() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
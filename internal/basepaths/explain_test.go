@@ -0,0 +1,123 @@
+package basepaths
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	alog "github.com/apex/log"
+	"github.com/apex/log/handlers/cli"
+	"github.com/houseabsolute/precious/internal/filetype"
+	"github.com/houseabsolute/precious/internal/pathfilter"
+	"github.com/houseabsolute/precious/internal/skip"
+)
+
+// The explain command is given paths relative to the cwd, while -a finds
+// absolute paths, and both must agree about which paths a glob matches.
+func TestExplainAgreesWithAllFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "precious-basepaths-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := []string{
+		"a.txt",
+		"a.go",
+		"sub/b.txt",
+		"sub/gen/c.txt",
+		"vendor/d.txt",
+		"vendor/x/e.txt",
+		StdinDirPrefix + "123/f.txt",
+		"sub/" + StdinDirPrefix + "456/g.txt",
+	}
+	for _, f := range files {
+		p := filepath.Join(root, filepath.FromSlash(f))
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte("x\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	l := &alog.Logger{Handler: cli.New(ioutil.Discard), Level: alog.ErrorLevel}
+	types := filetype.NewRegistry()
+	bp, err := New(l, AllFiles, root, types, []string{}, []string{"vendor/**/*"}, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := bp.Paths()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pf, err := pathfilter.New(root, types, []string{"**/*.txt"}, []string{}, []string{"sub/gen/**/*"}, []string{}, skip.Rules{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matched, err := pf.ApplyAllRules(found)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, p := range matched {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+
+	want := []string{"a.txt", "sub/b.txt"}
+	if len(got) != len(want) {
+		t.Fatalf("-a matched %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("-a matched %v, want %v", got, want)
+		}
+	}
+
+	for _, f := range files {
+		p := filepath.FromSlash(f)
+		reason, err := bp.Explain(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason == "" {
+			reason, err = pf.Explain(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		inAll := contains(got, f)
+		if inAll && reason != "" {
+			t.Errorf("-a matched %s but explain says it is skipped because %s", f, reason)
+		}
+		if !inAll && reason == "" {
+			t.Errorf("-a did not match %s but explain says it is not skipped", f)
+		}
+	}
+}
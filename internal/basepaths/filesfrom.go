@@ -0,0 +1,98 @@
+package basepaths
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// StdinFile is the file name to pass to SetFilesFrom to read paths from
+// stdin.
+const StdinFile = "-"
+
+// SetFilesFrom sets the file that the FromFile mode reads paths from. If
+// nulSeparated is true, the paths are separated by NUL bytes, as with
+// "find -print0" or "git diff -z". Otherwise there is one path per line.
+func (bf *BasePaths) SetFilesFrom(file string, nulSeparated bool) {
+	bf.filesFrom = file
+	bf.nulSeparated = nulSeparated
+}
+
+func (bf *BasePaths) pathsFromFile() ([]string, error) {
+	var r io.Reader
+	if bf.filesFrom == StdinFile {
+		bf.l.Info("Reading paths from stdin")
+		r = os.Stdin
+	} else {
+		bf.l.Infof("Reading paths from %s", bf.filesFrom)
+		f, err := os.Open(bf.filesFrom)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Could not open %s", bf.filesFrom))
+		}
+		defer f.Close()
+		r = f
+	}
+
+	paths, err := readPaths(r, bf.nulSeparated)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not read paths from %s", bf.filesFrom))
+	}
+
+	// We check every path up front so that the user sees all of the missing
+	// paths at once.
+	missing := []string{}
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) != 0 {
+		return nil, errors.Errorf("These paths from %s do not exist: %s", bf.filesFrom, strings.Join(missing, ", "))
+	}
+
+	return paths, nil
+}
+
+// Empty entries are skipped, so a trailing separator is fine. With newlines
+// we also strip a trailing CR from each line.
+func readPaths(r io.Reader, nulSeparated bool) ([]string, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	if nulSeparated {
+		s.Split(splitOnNUL)
+	}
+
+	paths := []string{}
+	seen := map[string]bool{}
+	for s.Scan() {
+		p := s.Text()
+		if !nulSeparated {
+			p = strings.TrimSuffix(p, "\r")
+		}
+		if p == "" || seen[p] {
+			continue
+		}
+		seen[p] = true
+		paths = append(paths, p)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+func splitOnNUL(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
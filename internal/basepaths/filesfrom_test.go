@@ -0,0 +1,72 @@
+package basepaths
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadPaths(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		nulSeparated bool
+		want         []string
+	}{
+		{
+			name:  "newlines",
+			input: "a.go\nsub/b.go\n",
+			want:  []string{"a.go", "sub/b.go"},
+		},
+		{
+			name:  "CRLF and no trailing newline",
+			input: "a.go\r\nsub/b.go",
+			want:  []string{"a.go", "sub/b.go"},
+		},
+		{
+			name:  "blank lines and duplicates",
+			input: "a.go\n\na.go\nb.go\n",
+			want:  []string{"a.go", "b.go"},
+		},
+		{
+			name:  "spaces are part of the path",
+			input: " a.go\nb c.go\n",
+			want:  []string{" a.go", "b c.go"},
+		},
+		{
+			name:         "NULs",
+			input:        "a.go\x00sub/b.go\x00",
+			nulSeparated: true,
+			want:         []string{"a.go", "sub/b.go"},
+		},
+		{
+			name:         "NULs keep newlines and CRs in paths",
+			input:        "new\nline.go\x00cr\r\x00last.go",
+			nulSeparated: true,
+			want:         []string{"new\nline.go", "cr\r", "last.go"},
+		},
+		{
+			name:         "NULs with empty entries",
+			input:        "\x00a.go\x00\x00a.go\x00",
+			nulSeparated: true,
+			want:         []string{"a.go"},
+		},
+		{
+			name:  "empty",
+			input: "",
+			want:  []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := readPaths(strings.NewReader(test.input), test.nulSeparated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("readPaths() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
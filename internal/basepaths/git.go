@@ -0,0 +1,216 @@
+package basepaths
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AutoBase is the ref to pass to SetBase to detect the base branch from the
+// environment.
+const AutoBase = "auto"
+
+// These are the environment variables that CI systems use for the branch a
+// pull request targets. The values are branch names, not refs.
+var ciBaseBranchVars = []string{
+	// GitHub Actions
+	"GITHUB_BASE_REF",
+	// GitLab CI
+	"CI_MERGE_REQUEST_TARGET_BRANCH_NAME",
+	// Bitbucket Pipelines
+	"BITBUCKET_PR_DESTINATION_BRANCH",
+	// Azure Pipelines, which uses "refs/heads/NAME"
+	"SYSTEM_PULLREQUEST_TARGETBRANCH",
+	// Buildkite
+	"BUILDKITE_PULL_REQUEST_BASE_BRANCH",
+	// Jenkins multibranch pipelines
+	"CHANGE_TARGET",
+	// Drone
+	"DRONE_TARGET_BRANCH",
+}
+
+// SetBase sets the ref that the GitBase mode compares against. If
+// includeWorktree is true, changes in the working tree that have not been
+// staged and untracked files are included as well.
+func (bf *BasePaths) SetBase(ref string, includeWorktree bool) {
+	bf.baseRef = ref
+	bf.includeWorktree = includeWorktree
+}
+
+func (bf *BasePaths) gitDiffPaths() ([]string, error) {
+	diffs, err := bf.gitDiffs()
+	if err != nil {
+		return nil, err
+	}
+	return diffPaths(diffs), nil
+}
+
+// The GitModified and GitStaged modes compare against HEAD, while the
+// GitBase mode compares against the merge base.
+func (bf *BasePaths) gitDiffs() ([]repoDiff, error) {
+	if bf.mode == GitBase {
+		return bf.baseDiffs()
+	}
+
+	top, err := bf.gitTopLevel()
+	if err != nil {
+		return nil, err
+	}
+
+	// Before the first commit there is no HEAD, and every file is new.
+	head := "HEAD"
+	if _, err := runGit(top, "rev-parse", "--verify", "--quiet", "HEAD^{commit}"); err != nil {
+		head = ""
+	}
+
+	return bf.repoDiffs(top, head, "")
+}
+
+// With --recurse-submodules, this includes the diffs for the submodules that
+// changed since the merge base.
+func (bf *BasePaths) baseDiffs() ([]repoDiff, error) {
+	top, err := bf.gitTopLevel()
+	if err != nil {
+		return nil, err
+	}
+
+	mergeBase, err := bf.mergeBase(top)
+	if err != nil {
+		return nil, err
+	}
+
+	return bf.repoDiffs(top, mergeBase, "")
+}
+
+// The merge base is cached since we need it both for the list of paths and
+// for the changed lines in those paths.
+func (bf *BasePaths) mergeBase(top string) (string, error) {
+	if bf.mergeBaseSHA != "" {
+		return bf.mergeBaseSHA, nil
+	}
+
+	ref := bf.baseRef
+	if ref == AutoBase {
+		var err error
+		ref, err = bf.detectBase(top)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	out, err := runGit(top, "merge-base", "HEAD", ref)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("Could not find the merge base of HEAD and %s", ref))
+	}
+	bf.mergeBaseSHA = strings.TrimSpace(out)
+	bf.l.Infof("Using paths changed since %s, the merge base of HEAD and %s", shortSHA(bf.mergeBaseSHA), ref)
+
+	return bf.mergeBaseSHA, nil
+}
+
+// Git never ignores a file that it tracks, so when git gives us the paths
+// we don't apply its ignore patterns to the tracked ones either.
+func (bf *BasePaths) markTracked(top string) error {
+	out, err := runGit(top, "ls-files", "-z")
+	if err != nil {
+		return err
+	}
+	bf.ignore.SetTracked(absPaths(top, splitNUL(out)))
+	return nil
+}
+
+func untrackedPaths(top string) ([]string, error) {
+	out, err := runGit(top, "ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	return splitNUL(out), nil
+}
+
+// We look at the CI environment first, then at the branch that the remote's
+// HEAD points to, which is usually the default branch.
+func (bf *BasePaths) detectBase(top string) (string, error) {
+	for _, v := range ciBaseBranchVars {
+		branch := strings.TrimPrefix(os.Getenv(v), "refs/heads/")
+		if branch == "" {
+			continue
+		}
+
+		// CI checkouts usually don't have a local branch for the target,
+		// just the remote tracking branch.
+		for _, ref := range []string{"origin/" + branch, branch} {
+			if _, err := runGit(top, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err == nil {
+				bf.l.Infof("Using %s as the base ref (detected from $%s)", ref, v)
+				return ref, nil
+			}
+		}
+		return "", errors.Errorf("The $%s environment variable is set to %s but there is no branch with that name. You may need to fetch it first.", v, branch)
+	}
+
+	out, err := runGit(top, "symbolic-ref", "--quiet", "--short", "refs/remotes/origin/HEAD")
+	if err == nil {
+		ref := strings.TrimSpace(out)
+		bf.l.Infof("Using %s as the base ref (the default branch of origin)", ref)
+		return ref, nil
+	}
+
+	return "", errors.New("Could not detect the base ref from the environment or from origin's default branch. Please pass a ref with --base")
+}
+
+func (bf *BasePaths) gitTopLevel() (string, error) {
+	out, err := runGit(bf.root, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("Could not find the git checkout for %s", bf.root))
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", errors.Wrap(err, fmt.Sprintf("Error running git %s", strings.Join(args, " ")))
+		}
+		return "", errors.Errorf("Error running git %s: %s", strings.Join(args, " "), msg)
+	}
+
+	return stdout.String(), nil
+}
+
+func splitNUL(out string) []string {
+	paths := []string{}
+	for _, p := range strings.Split(out, "\x00") {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// Git always gives us paths relative to the top of the checkout.
+func absPaths(top string, paths []string) []string {
+	abs := []string{}
+	for _, p := range paths {
+		abs = append(abs, filepath.Join(top, filepath.FromSlash(p)))
+	}
+	return abs
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
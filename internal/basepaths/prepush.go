@@ -0,0 +1,148 @@
+package basepaths
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/houseabsolute/precious/internal/gitrepo"
+	"github.com/pkg/errors"
+)
+
+// Git uses an object name of all zeros for a ref that does not exist, for
+// both SHA-1 and SHA-256 repos.
+var zeroSHARE = regexp.MustCompile(`^0+$`)
+
+// pushedRef is one of the lines that git passes to a pre-push hook on stdin.
+type pushedRef struct {
+	localRef  string
+	localSHA  string
+	remoteRef string
+	remoteSHA string
+}
+
+// The GitPrePush mode finds the files changed in the commits that are about
+// to be pushed. We return the paths as they are now, since the hook runs
+// against the working tree, and we skip any that no longer exist.
+func (bf *BasePaths) prePushPaths() ([]string, error) {
+	top, err := bf.gitTopLevel()
+	if err != nil {
+		return nil, err
+	}
+
+	err = bf.markTracked(top)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := readPushedRefs(os.Stdin)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not read the refs being pushed from stdin")
+	}
+
+	paths := []string{}
+	seen := map[string]bool{}
+	for _, r := range refs {
+		if zeroSHARE.MatchString(r.localSHA) {
+			bf.l.Debugf("Skipping %s since it is being deleted", r.remoteRef)
+			continue
+		}
+
+		args := []string{"log", "--format=", "--name-only", "-z", "--no-renames", "--diff-filter=d", r.localSHA, "--not"}
+		oldRev := ""
+		if bf.isKnownCommit(top, r.remoteSHA) {
+			bf.l.Infof("Using paths changed in the commits pushed from %s to %s", r.localRef, r.remoteRef)
+			args = append(args, r.remoteSHA)
+			oldRev = r.remoteSHA
+		} else {
+			// This is either a new branch or a push that overwrites commits
+			// we don't have locally. Either way, the best we can do is to
+			// look at the commits that aren't on any remote tracking branch.
+			bf.l.Infof("Using paths changed in the commits on %s that are not on any remote branch", r.localRef)
+			args = append(args, "--remotes")
+		}
+
+		out, err := runGit(top, args...)
+		if err != nil {
+			return nil, err
+		}
+		changed, err := bf.expandPushedSubmodules(top, absPaths(top, splitNUL(out)), oldRev, r.localSHA)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range changed {
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+
+			// A file can be changed in one pushed commit and then deleted
+			// in a later one.
+			if _, err := os.Stat(p); err != nil {
+				continue
+			}
+			paths = append(paths, p)
+		}
+	}
+
+	return paths, nil
+}
+
+// A submodule that changed in the pushed commits shows up as a single path.
+// We replace it with the paths that changed inside it between the commits
+// recorded for it at oldRev and newRev. If we don't know the old commit,
+// every file in the submodule is included.
+func (bf *BasePaths) expandPushedSubmodules(top string, paths []string, oldRev, newRev string) ([]string, error) {
+	expanded := []string{}
+	for _, p := range paths {
+		if !gitrepo.IsRoot(p) {
+			expanded = append(expanded, p)
+			continue
+		}
+
+		diffs, err := bf.submoduleDiffs(top, p, oldRev, newRev)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, diffPaths(diffs)...)
+	}
+	return expanded, nil
+}
+
+func (bf *BasePaths) isKnownCommit(top, sha string) bool {
+	if zeroSHARE.MatchString(sha) {
+		return false
+	}
+	_, err := runGit(top, "cat-file", "-e", sha+"^{commit}")
+	return err == nil
+}
+
+// Each line is "<local ref> <local sha> <remote ref> <remote sha>".
+func readPushedRefs(r io.Reader) ([]pushedRef, error) {
+	refs := []pushedRef{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if l == "" {
+			continue
+		}
+
+		f := strings.Fields(l)
+		if len(f) != 4 {
+			return nil, errors.Errorf("Expected a line like \"<local ref> <local sha> <remote ref> <remote sha>\" but got %q", l)
+		}
+		refs = append(refs, pushedRef{
+			localRef:  f[0],
+			localSHA:  f[1],
+			remoteRef: f[2],
+			remoteSHA: f[3],
+		})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
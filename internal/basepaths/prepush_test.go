@@ -0,0 +1,82 @@
+package basepaths
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadPushedRefs(t *testing.T) {
+	const (
+		zero   = "0000000000000000000000000000000000000000"
+		local  = "1111111111111111111111111111111111111111"
+		remote = "2222222222222222222222222222222222222222"
+	)
+
+	tests := []struct {
+		name  string
+		input string
+		want  []pushedRef
+	}{
+		{
+			name:  "update",
+			input: "refs/heads/main " + local + " refs/heads/main " + remote + "\n",
+			want:  []pushedRef{{"refs/heads/main", local, "refs/heads/main", remote}},
+		},
+		{
+			name:  "new branch",
+			input: "refs/heads/topic " + local + " refs/heads/topic " + zero + "\n",
+			want:  []pushedRef{{"refs/heads/topic", local, "refs/heads/topic", zero}},
+		},
+		{
+			name:  "deletion",
+			input: "(delete) " + zero + " refs/heads/old " + remote + "\n",
+			want:  []pushedRef{{"(delete)", zero, "refs/heads/old", remote}},
+		},
+		{
+			name: "several refs and blank lines",
+			input: "refs/heads/a " + local + " refs/heads/a " + remote + "\n\n" +
+				"refs/heads/b " + local + " refs/heads/b " + zero,
+			want: []pushedRef{
+				{"refs/heads/a", local, "refs/heads/a", remote},
+				{"refs/heads/b", local, "refs/heads/b", zero},
+			},
+		},
+		{
+			name:  "nothing pushed",
+			input: "",
+			want:  []pushedRef{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := readPushedRefs(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("readPushedRefs() = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	_, err := readPushedRefs(strings.NewReader("refs/heads/main " + local + "\n"))
+	if err == nil {
+		t.Error("readPushedRefs() returned no error for a line with two fields")
+	}
+}
+
+func TestDeletedRefIsZero(t *testing.T) {
+	for _, sha := range []string{
+		"0000000000000000000000000000000000000000",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+	} {
+		if !zeroSHARE.MatchString(sha) {
+			t.Errorf("%s is not treated as a missing ref", sha)
+		}
+	}
+	if zeroSHARE.MatchString("1000000000000000000000000000000000000000") {
+		t.Error("A SHA that is not all zeros is treated as a missing ref")
+	}
+}
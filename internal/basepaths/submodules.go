@@ -0,0 +1,152 @@
+package basepaths
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/houseabsolute/precious/internal/gitrepo"
+)
+
+// SetRecurseSubmodules sets whether paths inside submodules are included.
+// By default, the AllFiles mode does not descend into submodules and the git
+// modes ignore changes to them. With this set, the git modes look at the
+// changes inside each submodule that changed.
+func (bf *BasePaths) SetRecurseSubmodules(recurse bool) {
+	bf.recurseSubmodules = recurse
+}
+
+// repoDiff is the diff for one repository. The superproject and each
+// submodule that changed get their own diff, since each has its own history.
+type repoDiff struct {
+	top string
+	// These are the revs passed to git diff. If this is nil, the repo is a
+	// submodule that is new, and every file in it is new.
+	revs []string
+	// These are the absolute paths of the files that changed, not including
+	// any submodules.
+	paths []string
+	// If this is true, the untracked files in the repo are included in the
+	// paths.
+	untracked bool
+}
+
+// repoDiffs returns the diff between oldRev and newRev for the repo at top,
+// followed by the diffs for any submodules that changed. If newRev is
+// empty, the diff is against the index, or the working tree if
+// includeWorktree is set. If oldRev is empty, every file is new.
+func (bf *BasePaths) repoDiffs(top, oldRev, newRev string) ([]repoDiff, error) {
+	d := repoDiff{top: top}
+
+	err := bf.markTracked(top)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if oldRev == "" {
+		out, err := runGit(top, "ls-files", "-z")
+		if err != nil {
+			return nil, err
+		}
+		names = splitNUL(out)
+
+		if newRev == "" && bf.includeWorktree {
+			untracked, err := untrackedPaths(top)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, untracked...)
+		}
+	} else {
+		d.revs = bf.diffRevs(oldRev, newRev)
+		args := append([]string{"diff", "--name-only", "-z", "--no-renames", "--diff-filter=d"}, d.revs...)
+		out, err := runGit(top, args...)
+		if err != nil {
+			return nil, err
+		}
+		names = splitNUL(out)
+
+		if newRev == "" && bf.includeWorktree {
+			d.untracked = true
+			untracked, err := untrackedPaths(top)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, untracked...)
+		}
+	}
+
+	diffs := []repoDiff{}
+	for _, p := range absPaths(top, names) {
+		if !gitrepo.IsRoot(p) {
+			d.paths = append(d.paths, p)
+			continue
+		}
+
+		sub, err := bf.submoduleDiffs(top, p, oldRev, newRev)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, sub...)
+	}
+
+	return append([]repoDiff{d}, diffs...), nil
+}
+
+// submoduleDiffs returns the diffs for the submodule at path, comparing the
+// commits that the superproject at top recorded for it at oldRev and
+// newRev. Without --recurse-submodules this returns nothing.
+func (bf *BasePaths) submoduleDiffs(top, path, oldRev, newRev string) ([]repoDiff, error) {
+	if !bf.recurseSubmodules {
+		bf.l.Debugf("Skipping the changes in the submodule at %s", path)
+		return nil, nil
+	}
+
+	rel, err := filepath.Rel(top, path)
+	if err != nil {
+		return nil, err
+	}
+	rel = filepath.ToSlash(rel)
+
+	subOld := recordedCommit(top, oldRev, rel)
+	subNew := ""
+	if newRev != "" {
+		subNew = recordedCommit(top, newRev, rel)
+	}
+
+	return bf.repoDiffs(path, subOld, subNew)
+}
+
+// With no newRev, comparing the index to oldRev finds everything committed
+// since then plus anything staged. Comparing the working tree finds unstaged
+// changes too.
+func (bf *BasePaths) diffRevs(oldRev, newRev string) []string {
+	if newRev != "" {
+		return []string{oldRev, newRev}
+	}
+	if bf.includeWorktree {
+		return []string{oldRev}
+	}
+	return []string{"--cached", oldRev}
+}
+
+// This returns the commit that the superproject at top recorded for the
+// submodule at rel as of rev, or an empty string if there was none.
+func recordedCommit(top, rev, rel string) string {
+	if rev == "" {
+		return ""
+	}
+	out, err := runGit(top, "rev-parse", "--verify", "--quiet", rev+":"+rel)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+func diffPaths(diffs []repoDiff) []string {
+	paths := []string{}
+	for _, d := range diffs {
+		paths = append(paths, d.paths...)
+	}
+	return paths
+}
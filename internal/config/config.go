@@ -2,12 +2,17 @@ package config
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
-	"reflect"
 	"sort"
-	"strings"
+	"time"
 
 	alog "github.com/apex/log"
+	"github.com/houseabsolute/precious/internal/filetype"
+	"github.com/houseabsolute/precious/internal/filter"
+	"github.com/houseabsolute/precious/internal/interpolate"
+	"github.com/houseabsolute/precious/internal/issue"
+	"github.com/houseabsolute/precious/internal/skip"
 	toml "github.com/pelletier/go-toml"
 	"github.com/pkg/errors"
 )
@@ -17,8 +22,10 @@ type server struct {
 }
 
 type command struct {
-	pathFlag    string
-	okExitCodes []int64
+	pathFlag             string
+	okExitCodes          []int64
+	lintFailureExitCodes []int64
+	stderrIsFailure      bool
 }
 
 type filterType string
@@ -30,33 +37,74 @@ const (
 )
 
 type filterConfig struct {
-	name    string
-	ignore  []string
-	include []string
-	exclude []string
-	typ     string
-	cmd     []string
-	args    []string
-	onDir   bool
-	server  *server
-	command *command
+	name         string
+	ignore       []string
+	include      []string
+	includeTypes []string
+	exclude      []string
+	typ          string
+	cmd          []string
+	args         []string
+	onDir        bool
+	env          map[string]string
+	pathPrepend  []string
+	workingDir   filter.WorkingDir
+	tags         []string
+	requires     *filter.Requirement
+	onMissing    filter.OnMissing
+	timeout      *time.Duration
+	retries      int
+	issueRegex   string
+	skip         skipConfig
+	server       *server
+	command      *command
 }
 
 type Config struct {
-	Ignore  []string
-	Exclude []string
-	filters []filterConfig
-	l       *alog.Logger
+	Ignore    []string
+	Exclude   []string
+	Profile   string
+	root      string
+	configDir string
+	timeout   time.Duration
+	types     *filetype.Registry
+	skip      skip.Rules
+	filters   []filterConfig
+	profiles  map[string]profile
+	l         *alog.Logger
+	// These are the filters that the profile in use removed. We keep them
+	// so that selecting one of them gives a useful error.
+	disabled []filterConfig
 }
 
-func NewFromFile(l *alog.Logger, file string) (*Config, error) {
-	tree, err := toml.LoadFile(file)
+func NewFromFile(l *alog.Logger, file, root string) (*Config, error) {
+	tree, err := loadTree(file)
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf("Error reading config from %s", file))
 	}
 
-	c := &Config{l: l}
-	msgs := validateAndSetConfig(l, c, tree, file)
+	configDir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error getting abs path for %s", file))
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not get your current working directory")
+	}
+
+	if root == "" {
+		root = configDir
+	}
+
+	vars := interpolate.Vars{
+		ConfigDir: configDir,
+		Root:      root,
+		Cwd:       cwd,
+	}
+
+	c := &Config{l: l, root: root, configDir: configDir}
+	msgs := validateAndSetConfig(l, c, tree, file, vars)
 	if len(msgs) != 0 {
 		combined := fmt.Sprintf("There was one or more errors with your configuration file at %s:\n", file)
 		for _, M := range msgs {
@@ -68,29 +116,40 @@ func NewFromFile(l *alog.Logger, file string) (*Config, error) {
 	return c, nil
 }
 
-func validateAndSetConfig(l *alog.Logger, c *Config, tree *toml.Tree, file string) []string {
+// Root returns the directory that relative paths in the config are resolved
+// against.
+func (c *Config) Root() string {
+	return c.root
+}
+
+func validateAndSetConfig(l *alog.Logger, c *Config, tree *toml.Tree, file string, vars interpolate.Vars) []string {
 	msgs := []string{}
 
-	c.Ignore = getStringOrStringArray("global", tree, "ignore", &msgs)
-	c.Exclude = getStringOrStringArray("global", tree, "exclude", &msgs)
-	c.filters = getFilters(l, tree, file, &msgs)
+	checkKeys("global", tree, joinKeyDefs(globalKeys, skipKeys), globalSectionKeys, &msgs)
+	c.Ignore = getIgnoreFiles("global", tree, "ignore", vars, &msgs)
+	c.Exclude = getExpandedStringOrStringArray("global", tree, "exclude", vars, &msgs)
+	if timeout := getDuration("global", tree, "timeout", &msgs); timeout != nil {
+		c.timeout = *timeout
+	}
+	c.skip = getSkipConfig("global", tree, &msgs).apply(skip.Default())
+	c.types = getTypes(tree, &msgs)
+	c.filters = getFilters(l, tree, file, vars, &msgs)
+	c.profiles = getProfiles(tree, vars, c.filters, &msgs)
+	checkTypeRefs(c, &msgs)
 
 	return msgs
 }
 
-func getFilters(l *alog.Logger, tree *toml.Tree, file string, msgs *[]string) []filterConfig {
+func getFilters(l *alog.Logger, tree *toml.Tree, file string, vars interpolate.Vars, msgs *[]string) []filterConfig {
 	if !tree.Has("servers") && !tree.Has("commands") {
 		*msgs = append(*msgs, fmt.Sprintf("You must define at least one server or command in your config file at %s", file))
 		return []filterConfig{}
 	}
 
-	filters := map[int]filterConfig{}
-
-	configRoot, err := filepath.Abs(filepath.Dir(file))
-	if err != nil {
-		*msgs = append(*msgs, fmt.Sprintf("Error getting abs path for %s", file))
-		return []filterConfig{}
-	}
+	// Filters are run in the order they appear in the config file. Trees
+	// decoded from YAML or JSON have no position, but in that case the order
+	// of the arrays is preserved, so we use a stable sort.
+	filters := []positionedFilter{}
 
 	if tree.Has("servers") {
 		l.Debug("Found [[servers]] in config")
@@ -102,7 +161,11 @@ func getFilters(l *alog.Logger, tree *toml.Tree, file string, msgs *[]string) []
 				line := t.Position().Line
 				name := t.Keys()[0]
 				l.Debugf("Found server %s at line %d", name, line)
-				filters[line] = treeToServer(l, configRoot, name, t.Get(name).([]*toml.Tree)[0], msgs)
+				body, ok := filterBody(t, name, msgs)
+				if !ok {
+					continue
+				}
+				filters = append(filters, positionedFilter{line, treeToServer(l, vars, name, body, msgs)})
 			}
 		default:
 			*msgs = append(*msgs,
@@ -120,7 +183,11 @@ func getFilters(l *alog.Logger, tree *toml.Tree, file string, msgs *[]string) []
 				line := t.Position().Line
 				name := t.Keys()[0]
 				l.Debugf("Found command %s at line %d", name, line)
-				filters[t.Position().Line] = treeToCommand(l, configRoot, name, t.Get(name).([]*toml.Tree)[0], msgs)
+				body, ok := filterBody(t, name, msgs)
+				if !ok {
+					continue
+				}
+				filters = append(filters, positionedFilter{line, treeToCommand(l, vars, name, body, msgs)})
 			}
 		default:
 			*msgs = append(*msgs,
@@ -128,194 +195,266 @@ func getFilters(l *alog.Logger, tree *toml.Tree, file string, msgs *[]string) []
 		}
 	}
 
-	keys := []int{}
-	for p := range filters {
-		keys = append(keys, p)
-	}
-	sort.Ints(keys)
+	sort.SliceStable(filters, func(i, j int) bool {
+		return filters[i].line < filters[j].line
+	})
 
 	sorted := []filterConfig{}
-	for _, k := range keys {
-		sorted = append(sorted, filters[k])
+	for _, f := range filters {
+		sorted = append(sorted, f.filter)
 	}
 
 	return sorted
 }
 
-func treeToServer(l *alog.Logger, configRoot, name string, s *toml.Tree, msgs *[]string) filterConfig {
-	f := baseFilterConfig(configRoot, name, s, msgs)
-	f.server = &server{port: getInt64(name, s, "port", msgs)}
+type positionedFilter struct {
+	line   int
+	filter filterConfig
+}
+
+// In TOML each filter is a [[commands.NAME]] table, which is an array of one
+// table. In YAML and JSON it's more natural to just use a map.
+func filterBody(t *toml.Tree, name string, msgs *[]string) (*toml.Tree, bool) {
+	switch body := t.Get(name).(type) {
+	case []*toml.Tree:
+		if len(body) == 1 {
+			return body[0], true
+		}
+	case *toml.Tree:
+		return body, true
+	}
+
+	*msgs = append(*msgs, fmt.Sprintf("The %s filter must be defined as a single table", name))
+	return nil, false
+}
+
+func treeToServer(l *alog.Logger, vars interpolate.Vars, name string, s *toml.Tree, msgs *[]string) filterConfig {
+	checkKeys(name, s, joinKeyDefs(filterKeys, skipKeys, serverKeys), nil, msgs)
+	f := baseFilterConfig(vars, name, s, msgs)
+	f.server = &server{port: getInt64(s, "port")}
 	l.Debugf("%+v", f)
 	return f
 }
 
-func treeToCommand(l *alog.Logger, configRoot, name string, c *toml.Tree, msgs *[]string) filterConfig {
-	f := baseFilterConfig(configRoot, name, c, msgs)
+func treeToCommand(l *alog.Logger, vars interpolate.Vars, name string, c *toml.Tree, msgs *[]string) filterConfig {
+	checkKeys(name, c, joinKeyDefs(filterKeys, skipKeys, commandKeys), nil, msgs)
+	f := baseFilterConfig(vars, name, c, msgs)
 	f.command = &command{
-		pathFlag:    getString(name, c, "path_flag", msgs),
-		okExitCodes: getInt64OrInt64Array(name, c, "ok_exit_codes", msgs),
+		pathFlag:             getString(c, "path_flag"),
+		okExitCodes:          getInt64OrInt64Array(c, "ok_exit_codes"),
+		lintFailureExitCodes: getInt64OrInt64Array(c, "lint_failure_exit_codes"),
+		stderrIsFailure:      getBool(c, "stderr_is_failure"),
+	}
+	for _, ok := range f.command.okExitCodes {
+		for _, failure := range f.command.lintFailureExitCodes {
+			if ok == failure {
+				*msgs = append(*msgs, fmt.Sprintf("The %s filter has %d in both ok_exit_codes and lint_failure_exit_codes", name, ok))
+			}
+		}
 	}
 	l.Debugf("%+v", f)
 	return f
 }
 
-func baseFilterConfig(configRoot, name string, t *toml.Tree, msgs *[]string) filterConfig {
-	return filterConfig{
-		name:    name,
-		ignore:  getStringOrStringArray(name, t, "ignore", msgs),
-		exclude: getStringOrStringArray(name, t, "exclude", msgs),
-		include: getStringOrStringArray(name, t, "include", msgs),
-		typ:     getString(name, t, "type", msgs),
-		cmd:     getStringOrStringArray(name, t, "cmd", msgs),
-		args:    applyRoot(configRoot, getStringOrStringArray(name, t, "args", msgs)),
-		onDir:   getBool(name, t, "on_dir", msgs),
+func baseFilterConfig(vars interpolate.Vars, name string, t *toml.Tree, msgs *[]string) filterConfig {
+	f := filterConfig{
+		name:         name,
+		ignore:       getIgnoreFiles(name, t, "ignore", vars, msgs),
+		exclude:      getExpandedStringOrStringArray(name, t, "exclude", vars, msgs),
+		include:      getExpandedStringOrStringArray(name, t, "include", vars, msgs),
+		includeTypes: getStringOrStringArray(t, "include_types"),
+		typ:          getString(t, "type"),
+		cmd:          getExpandedStringOrStringArray(name, t, "cmd", vars, msgs),
+		args:         getExpandedStringOrStringArray(name, t, "args", vars, msgs),
+		onDir:        getBool(t, "on_dir"),
+		env:          getExpandedStringMap(name, t, "env", vars, msgs),
+		pathPrepend:  getExpandedStringOrStringArray(name, t, "path_prepend", vars, msgs),
+		workingDir:   getWorkingDir(name, t, "working_dir", msgs),
+		tags:         getStringOrStringArray(t, "tags"),
+		onMissing:    getOnMissing(name, t, "on_missing", msgs),
+		timeout:      getDuration(name, t, "timeout", msgs),
+		retries:      getRetries(name, t, "retries", msgs),
+		issueRegex:   getIssueRegex(name, t, "issue_regex", msgs),
+		skip:         getSkipConfig(name, t, msgs),
 	}
+	f.requires = getRequirement(name, t, vars, f.cmd, msgs)
+
+	return f
 }
 
-func getString(name string, tree *toml.Tree, key string, msgs *[]string) string {
-	if !tree.Has(key) {
-		return ""
+func getString(tree *toml.Tree, key string) string {
+	s, _ := tree.Get(key).(string)
+	return s
+}
+
+func getStringOrStringArray(tree *toml.Tree, key string) []string {
+	vals, ok := stringOrStringArray(tree.Get(key))
+	if !ok {
+		return []string{}
 	}
+	return vals
+}
 
-	raw := tree.Get(key)
-	if val, ok := raw.(string); ok {
-		return val
+// This expands $CONFIG_DIR, $ROOT, $CWD, and ${env:...} variables. The
+// per-invocation placeholders like {path} are left alone since they are only
+// known when a filter is run.
+func getExpandedStringOrStringArray(name string, tree *toml.Tree, key string, vars interpolate.Vars, msgs *[]string) []string {
+	vals := getStringOrStringArray(tree, key)
+
+	expanded, err := vars.ExpandAll(vals)
+	if err != nil {
+		*msgs = append(*msgs, fmt.Sprintf("The %s.%s key could not be expanded: %s", name, key, err))
+		return []string{}
 	}
 
-	*msgs = append(*msgs, fmt.Sprintf("The %s.%s key must be a string, not a %s", name, key, reflect.TypeOf(raw)))
+	return expanded
+}
 
-	return ""
+// Relative ignore files are relative to the config file's directory, not to
+// wherever precious happens to be run from.
+func getIgnoreFiles(name string, tree *toml.Tree, key string, vars interpolate.Vars, msgs *[]string) []string {
+	files := []string{}
+	for _, f := range getExpandedStringOrStringArray(name, tree, key, vars, msgs) {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(vars.ConfigDir, f)
+		}
+		files = append(files, f)
+	}
+	return files
 }
 
-func getStringOrStringArray(name string, tree *toml.Tree, key string, msgs *[]string) []string {
-	if !tree.Has(key) {
-		return []string{}
+func getExpandedStringMap(name string, tree *toml.Tree, key string, vars interpolate.Vars, msgs *[]string) map[string]string {
+	t, ok := tree.Get(key).(*toml.Tree)
+	if !ok {
+		return map[string]string{}
 	}
 
-	raw := tree.Get(key)
-	switch val := raw.(type) {
-	case string:
-		return []string{val}
-	case []interface{}:
-		vals := []string{}
-		for _, r := range val {
-			if v, ok := r.(string); ok {
-				vals = append(vals, v)
-			} else {
-				vals = []string{}
-				break
-			}
-		}
-		if len(vals) != 0 {
-			return vals
+	vals := map[string]string{}
+	for _, k := range t.Keys() {
+		v := getString(t, k)
+		expanded, err := vars.Expand(v)
+		if err != nil {
+			*msgs = append(*msgs, fmt.Sprintf("The %s.%s.%s key could not be expanded: %s", name, key, k, err))
+			continue
 		}
+		vals[k] = expanded
 	}
 
-	*msgs = append(*msgs, fmt.Sprintf("The %s %s key must be a string or array of strings, not a %s", name, key, reflect.TypeOf(raw)))
+	return vals
+}
 
-	return []string{}
+func getWorkingDir(name string, tree *toml.Tree, key string, msgs *[]string) filter.WorkingDir {
+	wd, err := filter.ParseWorkingDir(getString(tree, key))
+	if err != nil {
+		*msgs = append(*msgs, fmt.Sprintf("The %s.%s key is invalid: %s", name, key, err))
+	}
+	return wd
 }
 
-func getBool(name string, tree *toml.Tree, key string, msgs *[]string) bool {
-	if !tree.Has(key) {
-		return false
+// The cmd has already been expanded.
+func getRequirement(name string, tree *toml.Tree, vars interpolate.Vars, cmd []string, msgs *[]string) *filter.Requirement {
+	requires := getString(tree, "requires")
+	versionCmd := getExpandedStringOrStringArray(name, tree, "version_cmd", vars, msgs)
+	versionRegex := getString(tree, "version_regex")
+
+	if requires == "" {
+		if len(versionCmd) != 0 || versionRegex != "" {
+			*msgs = append(*msgs, fmt.Sprintf("The %s filter sets version_cmd or version_regex without setting requires", name))
+			return nil
+		}
+
+		// Even without a requires key we check that the command exists so
+		// that the user gets a useful error.
+		if len(cmd) == 0 {
+			return nil
+		}
+		return filter.NewRequirement(cmd[0], nil)
+	}
+
+	requires, err := vars.Expand(requires)
+	if err != nil {
+		*msgs = append(*msgs, fmt.Sprintf("The %s.requires key could not be expanded: %s", name, err))
+		return nil
 	}
 
-	raw := tree.Get(key)
-	if val, ok := raw.(bool); ok {
-		return val
+	r, err := filter.ParseRequirement(requires, versionCmd, versionRegex)
+	if err != nil {
+		*msgs = append(*msgs, fmt.Sprintf("The %s.requires key is invalid: %s", name, err))
+		return nil
 	}
 
-	*msgs = append(*msgs, fmt.Sprintf("The %s.%s key must be a bool, not a %s", name, key, reflect.TypeOf(raw)))
+	return r
+}
 
-	return false
+func getOnMissing(name string, tree *toml.Tree, key string, msgs *[]string) filter.OnMissing {
+	om, err := filter.ParseOnMissing(getString(tree, key))
+	if err != nil {
+		*msgs = append(*msgs, fmt.Sprintf("The %s.%s key is invalid: %s", name, key, err))
+	}
+	return om
 }
 
-func getInt64(name string, tree *toml.Tree, key string, msgs *[]string) int64 {
+// This returns nil if the key is not set so that we can tell an unset
+// timeout apart from one that is explicitly set to "0".
+func getDuration(name string, tree *toml.Tree, key string, msgs *[]string) *time.Duration {
 	if !tree.Has(key) {
-		return 0
+		return nil
 	}
 
-	raw := tree.Get(key)
-	if val, ok := raw.(int64); ok {
-		return val
+	val := getString(tree, key)
+	if val == "" {
+		return nil
 	}
 
-	*msgs = append(*msgs, fmt.Sprintf("The %s.%s key must be an int, not a %s", name, key, reflect.TypeOf(raw)))
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		*msgs = append(*msgs, fmt.Sprintf(`The %s.%s key must be a duration like "30s" or "2m": %s`, name, key, err))
+		return nil
+	}
+	if d < 0 {
+		*msgs = append(*msgs, fmt.Sprintf("The %s.%s key cannot be negative", name, key))
+		return nil
+	}
 
-	return 0
+	return &d
 }
 
-func getInt64OrInt64Array(name string, tree *toml.Tree, key string, msgs *[]string) []int64 {
-	if !tree.Has(key) {
-		return []int64{}
+func getIssueRegex(name string, tree *toml.Tree, key string, msgs *[]string) string {
+	re := getString(tree, key)
+	if re == "" {
+		return issue.DefaultRegex
 	}
 
-	raw := tree.Get(key)
-	switch val := raw.(type) {
-	case int64:
-		return []int64{val}
-	case []interface{}:
-		vals := []int64{}
-		for _, r := range val {
-			if v, ok := r.(int64); ok {
-				vals = append(vals, v)
-			} else {
-				vals = []int64{}
-				break
-			}
-		}
-		if len(vals) != 0 {
-			return vals
-		}
+	_, err := issue.NewParser(re)
+	if err != nil {
+		*msgs = append(*msgs, fmt.Sprintf("The %s.%s key is invalid: %s", name, key, err))
 	}
-
-	*msgs = append(*msgs, fmt.Sprintf("The %s %s key must be an int or array of ints, not a %s", name, key, reflect.TypeOf(raw)))
-
-	return []int64{}
+	return re
 }
 
-func applyRoot(root string, vals []string) []string {
-	applied := []string{}
-	for _, v := range vals {
-		applied = append(applied, strings.Replace(v, "$CONFIG_DIR", root, -1))
+func getRetries(name string, tree *toml.Tree, key string, msgs *[]string) int {
+	r := getInt64(tree, key)
+	if r < 0 {
+		*msgs = append(*msgs, fmt.Sprintf("The %s.%s key cannot be negative", name, key))
+		return 0
 	}
-	return applied
+	return int(r)
 }
 
-func (c *Config) Tidyers() []tidyer.Tidyer {
-	tidyers := []*tidyer.Tidyer{}
-	for _, f := range c.filters {
-		if f.typ != lint {
-			var t *tidyer.Tidyer
-			var err error
-			if f.server != nil {
-				t, err = tidyer.NewServer(
-					f.name,
-					f.ignore,
-					f.include,
-					f.exclude,
-					f.cmd,
-					f.args,
-					f.onDir,
-					f.server.port,
-				)
-			} else {
-				t, err = tidyer.NewCommand(
-					f.name,
-					f.ignore,
-					f.include,
-					f.exclude,
-					f.cmd,
-					f.args,
-					f.onDir,
-					f.command.pathFlag,
-					f.command.okExitCodes,
-				)
-			}
+func getBool(tree *toml.Tree, key string) bool {
+	b, _ := tree.Get(key).(bool)
+	return b
+}
 
-			tidyers = append(tidyers, t)
-		}
+func getInt64(tree *toml.Tree, key string) int64 {
+	i, _ := tree.Get(key).(int64)
+	return i
+}
+
+func getInt64OrInt64Array(tree *toml.Tree, key string) []int64 {
+	vals, ok := intOrIntArray(tree.Get(key))
+	if !ok {
+		return []int64{}
 	}
-	return t
+	return vals
 }
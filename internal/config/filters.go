@@ -0,0 +1,80 @@
+package config
+
+import (
+	"github.com/houseabsolute/precious/internal/filter"
+)
+
+var filterTypes = map[string]filter.FilterType{
+	string(tidy): filter.Tidy,
+	lint:         filter.Lint,
+	both:         filter.Both,
+	// A filter without a type can be used for either.
+	"": filter.Both,
+}
+
+// Filters returns the filters defined in the config in the order they were
+// defined, after any selection or profile has been applied.
+func (c *Config) Filters() []*filter.Filter {
+	filters := []*filter.Filter{}
+	for _, f := range c.filters {
+		var nf *filter.Filter
+		if f.server != nil {
+			nf = filter.NewServer(
+				f.name,
+				f.ignore,
+				f.include,
+				f.exclude,
+				filterTypes[f.typ],
+				f.cmd,
+				f.args,
+				f.onDir,
+				int(f.server.port),
+				false,
+			)
+		} else {
+			nf = filter.NewCommand(
+				f.name,
+				f.ignore,
+				f.include,
+				f.exclude,
+				filterTypes[f.typ],
+				f.cmd,
+				f.args,
+				f.onDir,
+				f.command.pathFlag,
+				toInts(f.command.okExitCodes),
+			)
+			nf.Command.LintFailureExitCodes = toInts(f.command.lintFailureExitCodes)
+			nf.Command.StderrIsFailure = f.command.stderrIsFailure
+		}
+
+		nf.IncludeTypes = f.includeTypes
+		nf.Types = c.types
+		nf.Env = f.env
+		nf.PathPrepend = f.pathPrepend
+		nf.WorkingDir = f.workingDir
+		nf.Root = c.root
+		nf.ConfigDir = c.configDir
+		nf.Requires = f.requires
+		nf.OnMissing = f.onMissing
+		nf.Timeout = c.timeout
+		if f.timeout != nil {
+			nf.Timeout = *f.timeout
+		}
+		nf.Retries = f.retries
+		nf.IssueRegex = f.issueRegex
+		nf.Skip = f.skip.apply(c.skip)
+
+		filters = append(filters, nf)
+	}
+
+	return filters
+}
+
+func toInts(vals []int64) []int {
+	ints := []int{}
+	for _, v := range vals {
+		ints = append(ints, int(v))
+	}
+	return ints
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	toml "github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// FileNames are the config file names we look for in a directory. All of
+// these are decoded into the same internal representation, so the keys they
+// support are identical.
+var FileNames = []string{
+	"precious.toml",
+	"precious.yaml",
+	"precious.yml",
+	"precious.json",
+	".precious.toml",
+	".precious.yaml",
+	".precious.yml",
+	".precious.json",
+}
+
+// FindInDir returns the path to the config file in the given directory, or
+// an empty string if there isn't one. It is an error for a directory to
+// contain more than one config file, since it's not clear which one should be
+// used.
+func FindInDir(dir string) (string, error) {
+	found := []string{}
+	for _, n := range FileNames {
+		p := filepath.Join(dir, n)
+		_, err := os.Stat(p)
+		if err == nil {
+			found = append(found, p)
+		} else if !os.IsNotExist(err) {
+			return "", errors.Wrap(err, fmt.Sprintf("Could not stat %s", p))
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return found[0], nil
+	}
+
+	return "", errors.Errorf(
+		"Found more than one config file in %s (%s). Please remove all but one of them.",
+		dir, strings.Join(found, ", "))
+}
+
+func loadTree(file string) (*toml.Tree, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTree(content, filepath.Ext(file))
+}
+
+// The format is determined by the file's extension, which includes the
+// leading dot.
+func parseTree(content []byte, ext string) (*toml.Tree, error) {
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		return parseYAML(content)
+	case ".json":
+		return parseJSON(content)
+	}
+
+	return toml.LoadBytes(content)
+}
+
+func parseYAML(content []byte) (*toml.Tree, error) {
+	var raw interface{}
+	err := yaml.Unmarshal(content, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return treeFromDecoded(raw)
+}
+
+func parseJSON(content []byte) (*toml.Tree, error) {
+	var raw interface{}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	err := dec.Decode(&raw)
+	if err != nil {
+		if se, ok := err.(*json.SyntaxError); ok {
+			line := bytes.Count(content[:se.Offset], []byte("\n")) + 1
+			return nil, errors.Errorf("line %d: %s", line, se)
+		}
+		return nil, err
+	}
+
+	return treeFromDecoded(raw)
+}
+
+// The TOML tree is our internal config representation, so we convert the
+// output of the YAML and JSON decoders into the same types that the TOML
+// parser produces.
+func treeFromDecoded(raw interface{}) (*toml.Tree, error) {
+	if raw == nil {
+		return toml.TreeFromMap(map[string]interface{}{})
+	}
+
+	norm, err := normalizeDecoded(raw, "")
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := norm.(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("The top level of the config must be a map, not a %s", reflect.TypeOf(raw))
+	}
+
+	return toml.TreeFromMap(m)
+}
+
+func normalizeDecoded(raw interface{}, path string) (interface{}, error) {
+	switch val := raw.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range val {
+			ks, ok := k.(string)
+			if !ok {
+				return nil, errors.Errorf("The key %v in %s must be a string, not a %s", k, describePath(path), reflect.TypeOf(k))
+			}
+			n, err := normalizeDecoded(v, joinPath(path, ks))
+			if err != nil {
+				return nil, err
+			}
+			m[ks] = n
+		}
+		return m, nil
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range val {
+			n, err := normalizeDecoded(v, joinPath(path, k))
+			if err != nil {
+				return nil, err
+			}
+			m[k] = n
+		}
+		return m, nil
+	case []interface{}:
+		a := []interface{}{}
+		var first reflect.Type
+		for _, v := range val {
+			n, err := normalizeDecoded(v, path)
+			if err != nil {
+				return nil, err
+			}
+			// Like TOML, we require arrays to be homogeneous.
+			if first == nil {
+				first = reflect.TypeOf(n)
+			} else if reflect.TypeOf(n) != first {
+				return nil, errors.Errorf("The array in %s mixes values of different types", describePath(path))
+			}
+			a = append(a, n)
+		}
+		return a, nil
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i, nil
+		}
+		return val.Float64()
+	case int:
+		return int64(val), nil
+	case nil:
+		return nil, errors.Errorf("The value for %s cannot be null", describePath(path))
+	}
+
+	return raw, nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func describePath(path string) string {
+	if path == "" {
+		return "the top level of the config"
+	}
+	return path
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	alog "github.com/apex/log"
+	"github.com/apex/log/handlers/cli"
+	"github.com/houseabsolute/precious/internal/interpolate"
+)
+
+// Each case is the same config written in each format, and every format
+// must give the same config or the same errors.
+var formatTests = []struct {
+	name    string
+	toml    string
+	yaml    string
+	json    string
+	wantErr bool
+}{
+	{
+		name: "valid",
+		toml: `
+exclude = ["vendor/**/*", "$ROOT/gen/**/*"]
+timeout = "30s"
+
+[[commands]]
+  [[commands.gofmt]]
+  type    = "tidy"
+  include = "**/*.go"
+  cmd     = ["gofmt", "-w"]
+  env     = { GOFLAGS = "-mod=vendor" }
+  ok_exit_codes = 0
+
+[[commands]]
+  [[commands.vet]]
+  type    = "lint"
+  include = ["**/*.go", "**/*.s"]
+  cmd     = "go vet"
+  on_dir  = true
+  ok_exit_codes = [0]
+  lint_failure_exit_codes = [1, 2]
+  working_dir = "nearest:go.mod"
+`,
+		yaml: `
+exclude:
+  - vendor/**/*
+  - $ROOT/gen/**/*
+timeout: 30s
+commands:
+  - gofmt:
+      type: tidy
+      include: "**/*.go"
+      cmd: [gofmt, -w]
+      env:
+        GOFLAGS: -mod=vendor
+      ok_exit_codes: 0
+  - vet:
+      type: lint
+      include: ["**/*.go", "**/*.s"]
+      cmd: go vet
+      on_dir: true
+      ok_exit_codes: [0]
+      lint_failure_exit_codes: [1, 2]
+      working_dir: nearest:go.mod
+`,
+		json: `{
+  "exclude": ["vendor/**/*", "$ROOT/gen/**/*"],
+  "timeout": "30s",
+  "commands": [
+    {"gofmt": {
+      "type": "tidy",
+      "include": "**/*.go",
+      "cmd": ["gofmt", "-w"],
+      "env": {"GOFLAGS": "-mod=vendor"},
+      "ok_exit_codes": 0
+    }},
+    {"vet": {
+      "type": "lint",
+      "include": ["**/*.go", "**/*.s"],
+      "cmd": "go vet",
+      "on_dir": true,
+      "ok_exit_codes": [0],
+      "lint_failure_exit_codes": [1, 2],
+      "working_dir": "nearest:go.mod"
+    }}
+  ]
+}`,
+	},
+	{
+		name: "type errors",
+		toml: `
+timeout = 30
+
+[[commands]]
+  [[commands.gofmt]]
+  type    = "tidy"
+  include = 42
+  cmd     = ["gofmt"]
+  on_dir  = "yes"
+  ok_exit_codes = ["0"]
+`,
+		yaml: `
+timeout: 30
+commands:
+  - gofmt:
+      type: tidy
+      include: 42
+      cmd: [gofmt]
+      on_dir: "yes"
+      ok_exit_codes: ["0"]
+`,
+		json: `{
+  "timeout": 30,
+  "commands": [
+    {"gofmt": {
+      "type": "tidy",
+      "include": 42,
+      "cmd": ["gofmt"],
+      "on_dir": "yes",
+      "ok_exit_codes": ["0"]
+    }}
+  ]
+}`,
+		wantErr: true,
+	},
+}
+
+func TestFormatsAreEquivalent(t *testing.T) {
+	l := &alog.Logger{Handler: cli.New(ioutil.Discard), Level: alog.ErrorLevel}
+	vars := interpolate.Vars{ConfigDir: "/project", Root: "/project", Cwd: "/project"}
+
+	for _, test := range formatTests {
+		t.Run(test.name, func(t *testing.T) {
+			var first *Config
+			var firstMsgs []string
+			for _, f := range []struct {
+				ext     string
+				content string
+			}{
+				{".toml", test.toml},
+				{".yaml", test.yaml},
+				{".json", test.json},
+			} {
+				tree, err := parseTree([]byte(f.content), f.ext)
+				if err != nil {
+					t.Fatalf("Could not parse the %s config: %s", f.ext, err)
+				}
+
+				c := &Config{l: l, root: vars.Root, configDir: vars.ConfigDir}
+				msgs := validateAndSetConfig(l, c, tree, "precious"+f.ext, vars)
+				if test.wantErr && len(msgs) == 0 {
+					t.Errorf("The %s config had no errors", f.ext)
+				}
+				if !test.wantErr && len(msgs) != 0 {
+					t.Errorf("The %s config had errors: %q", f.ext, msgs)
+				}
+
+				if first == nil {
+					first = c
+					firstMsgs = msgs
+					continue
+				}
+				if !reflect.DeepEqual(msgs, firstMsgs) {
+					t.Errorf("The %s config had the errors\n%q\nbut the TOML config had\n%q", f.ext, msgs, firstMsgs)
+				}
+				if test.wantErr {
+					continue
+				}
+				if !reflect.DeepEqual(c.filters, first.filters) {
+					t.Errorf("The %s config has the filters\n%+v\nbut the TOML config has\n%+v", f.ext, c.filters, first.filters)
+				}
+				if !reflect.DeepEqual(c.Exclude, first.Exclude) || c.timeout != first.timeout {
+					t.Errorf("The %s config's global settings differ from the TOML config's", f.ext)
+				}
+			}
+		})
+	}
+}
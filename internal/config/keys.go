@@ -0,0 +1,441 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/houseabsolute/precious/internal/issue"
+	"github.com/houseabsolute/precious/internal/skip"
+	toml "github.com/pelletier/go-toml"
+)
+
+type keyType int
+
+const (
+	stringKey keyType = iota
+	stringOrStringArrayKey
+	boolKey
+	intKey
+	intOrIntArrayKey
+	stringMapKey
+	stringArrayMapKey
+	sizeKey
+)
+
+// A keyDef describes a single config key. These definitions are used both
+// to validate the config and to generate the JSON Schema, so any new key
+// must be added here.
+type keyDef struct {
+	name string
+	typ  keyType
+	desc string
+	enum []string
+	def  interface{}
+}
+
+var globalKeys = []keyDef{
+	{
+		name: "ignore",
+		typ:  stringOrStringArrayKey,
+		desc: "One or more gitignore-style files, relative to the config file's directory. Paths matched by these files are never filtered.",
+	},
+	{
+		name: "exclude",
+		typ:  stringOrStringArrayKey,
+		desc: `One or more zglob patterns or "type:NAME" file types for paths that are never filtered.`,
+	},
+	{
+		name: "timeout",
+		typ:  stringKey,
+		desc: `The default timeout for filters that don't set their own, as a duration like "30s" or "2m". A timeout of "0" means no timeout.`,
+	},
+	{
+		name: "types",
+		typ:  stringArrayMapKey,
+		desc: `A table of file type names to one or more globs, as in perl = ["*.pl", "*.pm"]. A name that matches a built-in type adds globs to it. Types can be used in include_types, or as "type:NAME" in include and exclude.`,
+	},
+}
+
+// These keys can be set globally, in a profile, or for a single filter. A
+// profile's value overrides the global value, and a filter's value overrides
+// both.
+var skipKeys = []keyDef{
+	{
+		name: "skip_generated",
+		typ:  boolKey,
+		desc: "If true, files that look like they were generated are skipped. A file is generated if one of its first generated_lines lines matches generated_regex.",
+		def:  false,
+	},
+	{
+		name: "generated_regex",
+		typ:  stringKey,
+		desc: "The regex used to recognize generated files. Defaults to Go's \"Code generated ... DO NOT EDIT.\" marker.",
+		def:  skip.GeneratedRE.String(),
+	},
+	{
+		name: "generated_lines",
+		typ:  intKey,
+		desc: "The number of lines at the start of a file to check for generated_regex.",
+		def:  skip.DefaultGeneratedLines,
+	},
+	{
+		name: "skip_binary",
+		typ:  boolKey,
+		desc: "If true, files that look like binary files are skipped.",
+		def:  false,
+	},
+	{
+		name: "max_file_size",
+		typ:  sizeKey,
+		desc: `Files larger than this are skipped. This is a number of bytes or a size like "512K" or "2M".`,
+	},
+}
+
+var filterKeys = []keyDef{
+	{
+		name: "ignore",
+		typ:  stringOrStringArrayKey,
+		desc: "One or more gitignore-style files, relative to the config file's directory. Paths matched by these files are not filtered by this filter.",
+	},
+	{
+		name: "include",
+		typ:  stringOrStringArrayKey,
+		desc: `One or more zglob patterns or "type:NAME" file types for the paths this filter applies to.`,
+	},
+	{
+		name: "include_types",
+		typ:  stringOrStringArrayKey,
+		desc: `One or more file types this filter applies to, like "perl" or "shell". This can be a built-in type or one defined in the [types] table. Types are detected by file name, shebang line, or modeline, so this matches scripts without an extension. A path matching either include or include_types is included.`,
+	},
+	{
+		name: "exclude",
+		typ:  stringOrStringArrayKey,
+		desc: `One or more zglob patterns or "type:NAME" file types for paths this filter does not apply to, even if they are included.`,
+	},
+	{
+		name: "type",
+		typ:  stringKey,
+		desc: "Whether this filter tidies, lints, or does both.",
+		enum: []string{string(tidy), lint, both},
+	},
+	{
+		name: "cmd",
+		typ:  stringOrStringArrayKey,
+		desc: "The executable to run and any arguments that always come first.",
+	},
+	{
+		name: "args",
+		typ:  stringOrStringArrayKey,
+		desc: "Additional arguments. These may contain the {path}, {dir}, {relpath}, and {paths} placeholders. An argument that is exactly {paths} becomes one argument per path, while {paths} inside a larger argument becomes the paths joined with spaces.",
+	},
+	{
+		name: "on_dir",
+		typ:  boolKey,
+		desc: "If true, the filter is run on directories rather than individual files.",
+		def:  false,
+	},
+	{
+		name: "env",
+		typ:  stringMapKey,
+		desc: "Environment variables to set when running this filter. The values may contain the {path}, {dir}, {relpath}, and {paths} placeholders.",
+	},
+	{
+		name: "path_prepend",
+		typ:  stringOrStringArrayKey,
+		desc: "Directories to add to the front of PATH. Relative directories are relative to the working dir. These may contain the {path}, {dir}, and {relpath} placeholders.",
+	},
+	{
+		name: "working_dir",
+		typ:  stringKey,
+		desc: `The directory to run the filter from. One of "root", "config", "file", or "nearest:<marker file>".`,
+		def:  "root",
+	},
+	{
+		name: "tags",
+		typ:  stringOrStringArrayKey,
+		desc: "Tags that can be used to select this filter with --tag.",
+	},
+	{
+		name: "requires",
+		typ:  stringKey,
+		desc: `The tool this filter needs, with an optional version constraint, as in "golangci-lint >= 1.20". Defaults to the first element of cmd.`,
+	},
+	{
+		name: "version_cmd",
+		typ:  stringOrStringArrayKey,
+		desc: "The command to run to get the version of the required tool. Defaults to running the tool with --version.",
+	},
+	{
+		name: "version_regex",
+		typ:  stringKey,
+		desc: "A regex to extract the version from the output of version_cmd. If it has a capture group, the first group is the version.",
+	},
+	{
+		name: "on_missing",
+		typ:  stringKey,
+		desc: "What to do when the required tool is missing or does not meet the version constraint.",
+		enum: []string{"error", "skip"},
+		def:  "error",
+	},
+	{
+		name: "timeout",
+		typ:  stringKey,
+		desc: `How long one invocation of this filter may run before it is killed, as a duration like "30s" or "2m". A timeout of "0" means no timeout. Defaults to the global timeout.`,
+	},
+	{
+		name: "issue_regex",
+		typ:  stringKey,
+		desc: "A regex to find issues in this filter's output, used by --new-issues-only. It must have named groups for the path and line, and may have groups for the column and message.",
+		def:  issue.DefaultRegex,
+	},
+	{
+		name: "retries",
+		typ:  intKey,
+		desc: "The number of times to retry an invocation that times out. This is useful for tools that are known to be flaky.",
+		def:  0,
+	},
+}
+
+var commandKeys = []keyDef{
+	{
+		name: "path_flag",
+		typ:  stringKey,
+		desc: "A flag to pass before the paths, if the command requires one.",
+	},
+	{
+		name: "ok_exit_codes",
+		typ:  intOrIntArrayKey,
+		desc: "One or more exit codes that indicate that the command succeeded. Defaults to 0.",
+	},
+	{
+		name: "lint_failure_exit_codes",
+		typ:  intOrIntArrayKey,
+		desc: "One or more exit codes that indicate that the command found a problem with the code. Any other exit code that is not ok is treated as an error running the command. If this is not set, any exit code that is not ok is a lint failure.",
+	},
+	{
+		name: "stderr_is_failure",
+		typ:  boolKey,
+		desc: "If true, any output to stderr is treated as a lint failure, even when the exit code is ok.",
+		def:  false,
+	},
+}
+
+var serverKeys = []keyDef{
+	{
+		name: "port",
+		typ:  intKey,
+		desc: "The port the language server listens on.",
+	},
+}
+
+var profileKeys = []keyDef{
+	{
+		name: "enable",
+		typ:  stringOrStringArrayKey,
+		desc: "If set, only these filters are run when this profile is used.",
+	},
+	{
+		name: "disable",
+		typ:  stringOrStringArrayKey,
+		desc: "Filters that are not run when this profile is used.",
+	},
+	{
+		name: "args",
+		typ:  stringArrayMapKey,
+		desc: "A table of filter names to args which replace that filter's args.",
+	},
+	{
+		name: "ignore",
+		typ:  stringOrStringArrayKey,
+		desc: "Replaces the global ignore key.",
+	},
+	{
+		name: "exclude",
+		typ:  stringOrStringArrayKey,
+		desc: "Replaces the global exclude key.",
+	},
+	{
+		name: "timeout",
+		typ:  stringKey,
+		desc: "Replaces the global timeout key. Filters that set their own timeout still use it.",
+	},
+}
+
+// These are the keys which contain other sections of the config rather than
+// simple values.
+var globalSectionKeys = []string{"commands", "servers", "profiles"}
+
+func joinKeyDefs(defs ...[]keyDef) []keyDef {
+	joined := []keyDef{}
+	for _, d := range defs {
+		joined = append(joined, d...)
+	}
+	return joined
+}
+
+func checkKeys(section string, tree *toml.Tree, defs []keyDef, extra []string, msgs *[]string) {
+	known := map[string]keyDef{}
+	for _, d := range defs {
+		known[d.name] = d
+	}
+
+	keys := tree.Keys()
+	sort.Strings(keys)
+	for _, k := range keys {
+		d, ok := known[k]
+		if !ok {
+			if !contains(extra, k) {
+				*msgs = append(*msgs, fmt.Sprintf("The %s section has an unknown key, %s", section, k))
+			}
+			continue
+		}
+
+		if !checkType(section+"."+k, d.typ, tree.Get(k), msgs) {
+			continue
+		}
+
+		if len(d.enum) != 0 {
+			if s, ok := tree.Get(k).(string); ok && !contains(d.enum, s) {
+				*msgs = append(*msgs, fmt.Sprintf(
+					"The %s.%s key must be one of %s, not %q", section, k, strings.Join(d.enum, ", "), s))
+			}
+		}
+	}
+}
+
+// This is the only place that value types are checked, and it uses the same
+// keyDef types that the JSON Schema is generated from, so the two always
+// agree. The get* functions that read values assume that this has already
+// been called for the tree. It returns false if the value has the wrong
+// type.
+func checkType(name string, typ keyType, raw interface{}, msgs *[]string) bool {
+	ok := false
+	switch typ {
+	case stringKey:
+		_, ok = raw.(string)
+	case stringOrStringArrayKey:
+		_, ok = stringOrStringArray(raw)
+	case boolKey:
+		_, ok = raw.(bool)
+	case intKey:
+		_, ok = raw.(int64)
+	case intOrIntArrayKey:
+		_, ok = intOrIntArray(raw)
+	case sizeKey:
+		switch raw.(type) {
+		case int64, string:
+			ok = true
+		}
+	case stringMapKey, stringArrayMapKey:
+		t, isTree := raw.(*toml.Tree)
+		if !isTree {
+			*msgs = append(*msgs, fmt.Sprintf("The %s key must be a table, not %s", name, valueDesc(raw)))
+			return false
+		}
+
+		valType := stringKey
+		if typ == stringArrayMapKey {
+			valType = stringOrStringArrayKey
+		}
+		ok = true
+		keys := t.Keys()
+		sort.Strings(keys)
+		for _, k := range keys {
+			if !checkType(name+"."+k, valType, t.Get(k), msgs) {
+				ok = false
+			}
+		}
+		return ok
+	}
+
+	if !ok {
+		*msgs = append(*msgs, fmt.Sprintf("The %s key must be %s, not %s", name, typeDesc(typ), valueDesc(raw)))
+	}
+	return ok
+}
+
+func typeDesc(t keyType) string {
+	switch t {
+	case stringKey:
+		return "a string"
+	case stringOrStringArrayKey:
+		return "a string or a non-empty array of strings"
+	case boolKey:
+		return "a bool"
+	case intKey:
+		return "an int"
+	case intOrIntArrayKey:
+		return "an int or a non-empty array of ints"
+	case sizeKey:
+		return `an int or a string like "2M"`
+	}
+	return "a table"
+}
+
+// This describes a value the way the config formats do rather than by its Go
+// type, which differs between a config decoded from TOML and one decoded from
+// YAML or JSON.
+func valueDesc(raw interface{}) string {
+	switch raw.(type) {
+	case string:
+		return "a string"
+	case bool:
+		return "a bool"
+	case int64:
+		return "an int"
+	case float64:
+		return "a float"
+	case time.Time:
+		return "a date"
+	case *toml.Tree, []*toml.Tree:
+		return "a table"
+	}
+	if reflect.TypeOf(raw).Kind() == reflect.Slice {
+		return "an array"
+	}
+	return fmt.Sprintf("a %s", reflect.TypeOf(raw))
+}
+
+// Arrays must not be empty, as in the JSON Schema.
+func stringOrStringArray(raw interface{}) ([]string, bool) {
+	switch val := raw.(type) {
+	case string:
+		return []string{val}, true
+	case []string:
+		return val, len(val) != 0
+	case []interface{}:
+		vals := []string{}
+		for _, r := range val {
+			v, ok := r.(string)
+			if !ok {
+				return nil, false
+			}
+			vals = append(vals, v)
+		}
+		return vals, len(vals) != 0
+	}
+	return nil, false
+}
+
+func intOrIntArray(raw interface{}) ([]int64, bool) {
+	switch val := raw.(type) {
+	case int64:
+		return []int64{val}, true
+	case []int64:
+		return val, len(val) != 0
+	case []interface{}:
+		vals := []int64{}
+		for _, r := range val {
+			v, ok := r.(int64)
+			if !ok {
+				return nil, false
+			}
+			vals = append(vals, v)
+		}
+		return vals, len(vals) != 0
+	}
+	return nil, false
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/houseabsolute/precious/internal/interpolate"
+	toml "github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// A profile is a named set of overrides defined in a [profiles.NAME] table.
+// This lets one config file have, for example, a fast set of filters for a
+// commit hook and the full set for CI.
+type profile struct {
+	name    string
+	enable  []string
+	disable []string
+	args    map[string][]string
+	ignore  *[]string
+	exclude *[]string
+	timeout *time.Duration
+	skip    skipConfig
+}
+
+func getProfiles(tree *toml.Tree, vars interpolate.Vars, filters []filterConfig, msgs *[]string) map[string]profile {
+	profiles := map[string]profile{}
+	if !tree.Has("profiles") {
+		return profiles
+	}
+
+	raw := tree.Get("profiles")
+	t, ok := raw.(*toml.Tree)
+	if !ok {
+		*msgs = append(*msgs, fmt.Sprintf("The profiles key must be a table ([profiles.NAME]), not %s", valueDesc(raw)))
+		return profiles
+	}
+
+	names := map[string]bool{}
+	for _, f := range filters {
+		names[f.name] = true
+	}
+
+	for _, name := range t.Keys() {
+		raw := t.Get(name)
+		pt, ok := raw.(*toml.Tree)
+		if !ok {
+			*msgs = append(*msgs, fmt.Sprintf("The profiles.%s key must be a table, not %s", name, valueDesc(raw)))
+			continue
+		}
+		profiles[name] = treeToProfile(name, pt, vars, names, msgs)
+	}
+
+	return profiles
+}
+
+func treeToProfile(name string, t *toml.Tree, vars interpolate.Vars, filterNames map[string]bool, msgs *[]string) profile {
+	key := "profiles." + name
+	checkKeys(key, t, joinKeyDefs(profileKeys, skipKeys), nil, msgs)
+
+	p := profile{
+		name:    name,
+		enable:  getStringOrStringArray(t, "enable"),
+		disable: getStringOrStringArray(t, "disable"),
+		args:    map[string][]string{},
+	}
+
+	for _, f := range append(append([]string{}, p.enable...), p.disable...) {
+		if !filterNames[f] {
+			*msgs = append(*msgs, fmt.Sprintf("The %s profile refers to a filter named %s which does not exist", name, f))
+		}
+	}
+
+	if t.Has("ignore") {
+		ignore := getIgnoreFiles(key, t, "ignore", vars, msgs)
+		p.ignore = &ignore
+	}
+	if t.Has("exclude") {
+		exclude := getExpandedStringOrStringArray(key, t, "exclude", vars, msgs)
+		p.exclude = &exclude
+	}
+	p.timeout = getDuration(key, t, "timeout", msgs)
+	p.skip = getSkipConfig(key, t, msgs)
+
+	if at, ok := t.Get("args").(*toml.Tree); ok {
+		for _, f := range at.Keys() {
+			if !filterNames[f] {
+				*msgs = append(*msgs, fmt.Sprintf("The %s profile overrides args for a filter named %s which does not exist", name, f))
+				continue
+			}
+			p.args[f] = getExpandedStringOrStringArray(key+".args", at, f, vars, msgs)
+		}
+	}
+
+	return p
+}
+
+// UseProfile applies the overrides from the named profile. An empty name
+// means that no profile is used.
+func (c *Config) UseProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+
+	p, ok := c.profiles[name]
+	if !ok {
+		known := []string{}
+		for n := range c.profiles {
+			known = append(known, n)
+		}
+		sort.Strings(known)
+		if len(known) == 0 {
+			return errors.Errorf("There is no profile named %s because your config does not define any profiles", name)
+		}
+		return errors.Errorf("There is no profile named %s in your config (known profiles: %s)", name, strings.Join(known, ", "))
+	}
+
+	if p.ignore != nil {
+		c.Ignore = *p.ignore
+	}
+	if p.exclude != nil {
+		c.Exclude = *p.exclude
+	}
+	if p.timeout != nil {
+		c.timeout = *p.timeout
+	}
+	c.skip = p.skip.apply(c.skip)
+
+	filters := []filterConfig{}
+	for _, f := range c.filters {
+		if reason := p.disabledReason(f.name); reason != "" {
+			c.l.Debugf("Filter %s %s", f.name, reason)
+			c.disabled = append(c.disabled, f)
+			continue
+		}
+		if args, ok := p.args[f.name]; ok {
+			c.l.Debugf("Using args from the %s profile for filter %s: %s", name, f.name, args)
+			f.args = args
+		}
+		filters = append(filters, f)
+	}
+	c.filters = filters
+	c.Profile = name
+
+	return nil
+}
+
+// This returns the reason the profile removes the named filter, or an empty
+// string if it doesn't.
+func (p profile) disabledReason(name string) string {
+	if len(p.enable) != 0 && !contains(p.enable, name) {
+		return fmt.Sprintf("is not enabled by the %s profile", p.name)
+	}
+	if contains(p.disable, name) {
+		return fmt.Sprintf("is disabled by the %s profile", p.name)
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/houseabsolute/precious/internal/filter"
+	"github.com/pkg/errors"
+)
+
+// CheckRequirements checks that the tool each filter of the given type
+// requires is installed and meets its version constraint. Filters of the
+// other type and language server filters are not checked, since they won't
+// be run. A filter with on_missing = "skip" is removed with a warning rather
+// than causing an error. If a filter's tool can only be found once we know
+// the dir it runs in, it is checked when the filter is run instead.
+func (c *Config) CheckRequirements(typ filter.FilterType) error {
+	msgs := []string{}
+	skipped := map[string]bool{}
+	for _, f := range c.Filters() {
+		if f.Type != typ && f.Type != filter.Both {
+			continue
+		}
+		if f.Requires == nil || f.Server != nil {
+			continue
+		}
+		if f.RequirementIsDeferred() {
+			c.l.Debugf("The tool for the %s filter depends on the dir it runs in, so it will be checked when the filter is run", f.Name())
+			continue
+		}
+
+		exe, version, err := f.CheckRequirement()
+		if err == nil {
+			if version != "" {
+				c.l.Debugf("Found %s version %s for the %s filter", exe, version, f.Name())
+			} else {
+				c.l.Debugf("Found %s for the %s filter", exe, f.Name())
+			}
+			continue
+		}
+
+		if f.OnMissing == filter.OnMissingSkip {
+			c.l.Warnf("Skipping the %s filter: %s", f.Name(), err)
+			skipped[f.Name()] = true
+			continue
+		}
+
+		msgs = append(msgs, fmt.Sprintf("The %s filter cannot be run: %s", f.Name(), err))
+	}
+
+	if len(msgs) != 0 {
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+
+	filters := []filterConfig{}
+	for _, f := range c.filters {
+		if !skipped[f.name] {
+			filters = append(filters, f)
+		}
+	}
+	c.filters = filters
+
+	return nil
+}
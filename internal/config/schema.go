@@ -0,0 +1,157 @@
+package config
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// JSONSchema returns a JSON Schema document describing the config file. It
+// is generated from the same key definitions used to validate the config.
+// The schema describes the TOML layout, which the YAML and JSON formats
+// share.
+func JSONSchema() ([]byte, error) {
+	schema := map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                "precious config",
+		"description":          "The config file for precious, a tool to run tidiers and linters.",
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": mergeProperties(
+			propertiesFor(joinKeyDefs(globalKeys, skipKeys)),
+			map[string]interface{}{
+				"commands": filterListSchema("command", "An array of command filter definitions ([[commands]])."),
+				"servers":  filterListSchema("server", "An array of language server filter definitions ([[servers]])."),
+				"profiles": map[string]interface{}{
+					"description":          "Named profiles which override parts of the config ([profiles.NAME]).",
+					"type":                 "object",
+					"additionalProperties": map[string]interface{}{"$ref": "#/definitions/profile"},
+				},
+			},
+		),
+		"definitions": map[string]interface{}{
+			"command": objectSchema(joinKeyDefs(filterKeys, skipKeys, commandKeys)),
+			"server":  objectSchema(joinKeyDefs(filterKeys, skipKeys, serverKeys)),
+			"profile": objectSchema(joinKeyDefs(profileKeys, skipKeys)),
+		},
+	}
+
+	out, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not encode the JSON Schema")
+	}
+
+	return append(out, '\n'), nil
+}
+
+// Each element of the array is a table with a single key, the filter's
+// name. In TOML the value is itself an array of one table.
+func filterListSchema(def, desc string) map[string]interface{} {
+	ref := map[string]interface{}{"$ref": "#/definitions/" + def}
+	return map[string]interface{}{
+		"description": desc,
+		"type":        "array",
+		"items": map[string]interface{}{
+			"type":          "object",
+			"minProperties": 1,
+			"maxProperties": 1,
+			"additionalProperties": map[string]interface{}{
+				"oneOf": []interface{}{
+					ref,
+					map[string]interface{}{
+						"type":     "array",
+						"items":    ref,
+						"minItems": 1,
+						"maxItems": 1,
+					},
+				},
+			},
+		},
+	}
+}
+
+func objectSchema(defs []keyDef) map[string]interface{} {
+	return map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties":           propertiesFor(defs),
+	}
+}
+
+func propertiesFor(defs []keyDef) map[string]interface{} {
+	props := map[string]interface{}{}
+	for _, d := range defs {
+		props[d.name] = keySchema(d)
+	}
+	return props
+}
+
+func mergeProperties(props ...map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for _, p := range props {
+		for k, v := range p {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func keySchema(d keyDef) map[string]interface{} {
+	s := typeSchema(d.typ)
+	s["description"] = d.desc
+	if len(d.enum) != 0 {
+		s["enum"] = d.enum
+	}
+	if d.def != nil {
+		s["default"] = d.def
+	}
+	return s
+}
+
+func typeSchema(t keyType) map[string]interface{} {
+	str := map[string]interface{}{"type": "string"}
+	strArray := map[string]interface{}{
+		"type":     "array",
+		"items":    str,
+		"minItems": 1,
+	}
+	integer := map[string]interface{}{"type": "integer"}
+
+	switch t {
+	case stringKey:
+		return map[string]interface{}{"type": "string"}
+	case stringOrStringArrayKey:
+		return map[string]interface{}{"anyOf": []interface{}{str, strArray}}
+	case boolKey:
+		return map[string]interface{}{"type": "boolean"}
+	case intKey:
+		return map[string]interface{}{"type": "integer"}
+	case intOrIntArrayKey:
+		return map[string]interface{}{
+			"anyOf": []interface{}{
+				integer,
+				map[string]interface{}{
+					"type":     "array",
+					"items":    integer,
+					"minItems": 1,
+				},
+			},
+		}
+	case stringMapKey:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": str,
+		}
+	case sizeKey:
+		return map[string]interface{}{"anyOf": []interface{}{integer, str}}
+	case stringArrayMapKey:
+		return map[string]interface{}{
+			"type": "object",
+			"additionalProperties": map[string]interface{}{
+				"anyOf": []interface{}{str, strArray},
+			},
+		}
+	}
+
+	return map[string]interface{}{}
+}
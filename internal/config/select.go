@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Selection describes which filters to run, as given on the command line.
+// Each value may contain a comma-separated list of names.
+type Selection struct {
+	Only []string
+	Skip []string
+	Tags []string
+}
+
+// Select removes any filters that are not part of the given selection. If
+// only or tags are given, a filter is kept if its name is in only or it has
+// one of the tags. Then any filter in skip is removed. It is an error to
+// refer to a filter name or tag which does not exist in the config, or to
+// select only filters that the profile in use removed.
+func (c *Config) Select(sel Selection) error {
+	only := splitNames(sel.Only)
+	skip := splitNames(sel.Skip)
+	tags := splitNames(sel.Tags)
+
+	names := map[string]bool{}
+	allTags := map[string]bool{}
+	for _, f := range c.filters {
+		names[f.name] = true
+		for _, t := range f.tags {
+			allTags[t] = true
+		}
+	}
+
+	// Skipping a filter that the profile removed is harmless, but asking
+	// for only that filter would run nothing.
+	disabled := map[string]bool{}
+	disabledTags := map[string]bool{}
+	for _, f := range c.disabled {
+		disabled[f.name] = true
+		for _, t := range f.tags {
+			disabledTags[t] = true
+		}
+	}
+
+	msgs := []string{}
+	for _, n := range only {
+		if disabled[n] {
+			msgs = append(msgs, fmt.Sprintf("The %s filter %s, so it cannot be selected with --only", n, c.profiles[c.Profile].disabledReason(n)))
+		} else if !names[n] {
+			msgs = append(msgs, fmt.Sprintf("There is no filter named %s in your config (known filters: %s)", n, joinKeys(names)))
+		}
+	}
+	for _, n := range skip {
+		if !names[n] && !disabled[n] {
+			msgs = append(msgs, fmt.Sprintf("There is no filter named %s in your config (known filters: %s)", n, joinKeys(names)))
+		}
+	}
+	for _, t := range tags {
+		if allTags[t] {
+			continue
+		}
+		if disabledTags[t] {
+			msgs = append(msgs, fmt.Sprintf("Every filter with the tag %s was removed by the %s profile", t, c.Profile))
+		} else {
+			msgs = append(msgs, fmt.Sprintf("No filter in your config has the tag %s (known tags: %s)", t, joinKeys(allTags)))
+		}
+	}
+	if len(msgs) != 0 {
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+
+	selected := []filterConfig{}
+	for _, f := range c.filters {
+		if (len(only) != 0 || len(tags) != 0) && !contains(only, f.name) && !hasAny(f.tags, tags) {
+			c.l.Debugf("Filter %s was not selected with --only or --tag", f.name)
+			continue
+		}
+		if contains(skip, f.name) {
+			c.l.Debugf("Skipping filter %s because of --skip", f.name)
+			continue
+		}
+		selected = append(selected, f)
+	}
+	c.filters = selected
+
+	return nil
+}
+
+func splitNames(vals []string) []string {
+	names := []string{}
+	for _, v := range vals {
+		for _, n := range strings.Split(v, ",") {
+			n = strings.TrimSpace(n)
+			if n != "" {
+				names = append(names, n)
+			}
+		}
+	}
+	return names
+}
+
+func contains(vals []string, s string) bool {
+	for _, v := range vals {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAny(vals, want []string) bool {
+	for _, w := range want {
+		if contains(vals, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinKeys(m map[string]bool) string {
+	if len(m) == 0 {
+		return "none"
+	}
+
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/houseabsolute/precious/internal/skip"
+	toml "github.com/pelletier/go-toml"
+)
+
+// The skip keys can be set globally and for each filter. Each key that a
+// filter sets overrides the global value, so we need to know which keys were
+// set.
+type skipConfig struct {
+	generated      *bool
+	generatedRegex *regexp.Regexp
+	generatedLines *int
+	binary         *bool
+	maxFileSize    *int64
+}
+
+func getSkipConfig(name string, tree *toml.Tree, msgs *[]string) skipConfig {
+	sc := skipConfig{}
+
+	if tree.Has("skip_generated") {
+		b := getBool(tree, "skip_generated")
+		sc.generated = &b
+	}
+	if tree.Has("generated_regex") {
+		s := getString(tree, "generated_regex")
+		re, err := regexp.Compile(s)
+		if err != nil {
+			*msgs = append(*msgs, fmt.Sprintf("The %s.generated_regex key is not a valid regex: %s", name, err))
+		} else {
+			sc.generatedRegex = re
+		}
+	}
+	if tree.Has("generated_lines") {
+		n := getInt64(tree, "generated_lines")
+		if n < 1 {
+			*msgs = append(*msgs, fmt.Sprintf("The %s.generated_lines key must be at least 1", name))
+		} else {
+			i := int(n)
+			sc.generatedLines = &i
+		}
+	}
+	if tree.Has("skip_binary") {
+		b := getBool(tree, "skip_binary")
+		sc.binary = &b
+	}
+	if tree.Has("max_file_size") {
+		sc.maxFileSize = getSize(name, tree, "max_file_size", msgs)
+	}
+
+	return sc
+}
+
+// A size can be given as a number of bytes or as a string like "2M".
+func getSize(name string, tree *toml.Tree, key string, msgs *[]string) *int64 {
+	var size int64
+	switch raw := tree.Get(key).(type) {
+	case int64:
+		size = raw
+	case string:
+		s, err := skip.ParseSize(raw)
+		if err != nil {
+			*msgs = append(*msgs, fmt.Sprintf("The %s.%s key is invalid: %s", name, key, err))
+			return nil
+		}
+		size = s
+	default:
+		return nil
+	}
+
+	if size < 0 {
+		*msgs = append(*msgs, fmt.Sprintf("The %s.%s key cannot be negative", name, key))
+		return nil
+	}
+
+	return &size
+}
+
+func (sc skipConfig) apply(r skip.Rules) skip.Rules {
+	if sc.generated != nil {
+		r.Generated = *sc.generated
+	}
+	if sc.generatedRegex != nil {
+		r.GeneratedRegex = sc.generatedRegex
+	}
+	if sc.generatedLines != nil {
+		r.GeneratedLines = *sc.generatedLines
+	}
+	if sc.binary != nil {
+		r.Binary = *sc.binary
+	}
+	if sc.maxFileSize != nil {
+		r.MaxSize = *sc.maxFileSize
+	}
+	return r
+}
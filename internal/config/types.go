@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/houseabsolute/precious/internal/filetype"
+	"github.com/houseabsolute/precious/internal/pathfilter"
+	toml "github.com/pelletier/go-toml"
+)
+
+// Types returns the registry of file types, which includes the built-in
+// types and any defined in the [types] table.
+func (c *Config) Types() *filetype.Registry {
+	return c.types
+}
+
+// The [types] table maps a type name to one or more globs. A name that
+// matches a built-in type adds globs to that type.
+func getTypes(tree *toml.Tree, msgs *[]string) *filetype.Registry {
+	types := filetype.NewRegistry()
+	t, ok := tree.Get("types").(*toml.Tree)
+	if !ok {
+		return types
+	}
+
+	names := t.Keys()
+	sort.Strings(names)
+	for _, name := range names {
+		globs := getStringOrStringArray(t, name)
+		if len(globs) == 0 {
+			continue
+		}
+		err := types.Add(name, globs)
+		if err != nil {
+			*msgs = append(*msgs, err.Error())
+		}
+	}
+
+	return types
+}
+
+// Types can be referred to in include_types or as "type:NAME" in any include
+// or exclude key, so we check all of those once the [types] table has been
+// read.
+func checkTypeRefs(c *Config, msgs *[]string) {
+	check := func(section, key string, names []string) {
+		for _, n := range names {
+			if c.types.Lookup(n) == nil {
+				*msgs = append(*msgs, fmt.Sprintf(
+					"The %s.%s key contains an unknown file type, %s. The known types are %s.",
+					section, key, n, strings.Join(c.types.Names(), ", ")))
+			}
+		}
+	}
+
+	check("global", "exclude", typeRefs(c.Exclude))
+	for _, f := range c.filters {
+		check(f.name, "include", typeRefs(f.include))
+		check(f.name, "include_types", f.includeTypes)
+		check(f.name, "exclude", typeRefs(f.exclude))
+	}
+	for _, p := range c.profiles {
+		if p.exclude != nil {
+			check("profiles."+p.name, "exclude", typeRefs(*p.exclude))
+		}
+	}
+}
+
+func typeRefs(entries []string) []string {
+	names := []string{}
+	for _, e := range entries {
+		if strings.HasPrefix(e, pathfilter.TypePrefix) {
+			names = append(names, strings.TrimPrefix(e, pathfilter.TypePrefix))
+		}
+	}
+	return names
+}
@@ -0,0 +1,180 @@
+package doctor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	alog "github.com/apex/log"
+	"github.com/houseabsolute/precious/internal/config"
+	"github.com/houseabsolute/precious/internal/filter"
+	"github.com/houseabsolute/precious/internal/gitignore"
+)
+
+type Status int
+
+const (
+	Pass Status = iota
+	Warn
+	Fail
+)
+
+func (s Status) String() string {
+	switch s {
+	case Pass:
+		return "PASS"
+	case Warn:
+		return "WARN"
+	}
+	return "FAIL"
+}
+
+// Check is the result of a single diagnostic.
+type Check struct {
+	Status  Status
+	Subject string
+	Message string
+}
+
+// ServerTimeout is how long we wait for a server to accept a connection and
+// answer the initialize request.
+const ServerTimeout = 10 * time.Second
+
+type Doctor struct {
+	l      *alog.Logger
+	c      *config.Config
+	checks []*Check
+}
+
+func New(l *alog.Logger, c *config.Config) *Doctor {
+	return &Doctor{l: l, c: c}
+}
+
+// Run runs all of the diagnostics and returns their results in the order
+// they were run.
+func (d *Doctor) Run() []*Check {
+	d.checks = []*Check{}
+
+	for _, f := range d.c.Filters() {
+		d.checkFilter(f)
+	}
+	d.checkIgnoreFiles("global config", d.c.Ignore)
+	d.checkGit()
+
+	return d.checks
+}
+
+// Print writes the checks as a checklist.
+func Print(w io.Writer, checks []*Check) {
+	for _, c := range checks {
+		fmt.Fprintf(w, "[%s] %s: %s\n", c.Status, c.Subject, c.Message)
+	}
+}
+
+// Failed returns true if any of the checks failed.
+func Failed(checks []*Check) bool {
+	for _, c := range checks {
+		if c.Status == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Doctor) add(status Status, subject, format string, args ...interface{}) {
+	d.checks = append(d.checks, &Check{status, subject, fmt.Sprintf(format, args...)})
+}
+
+func (d *Doctor) checkFilter(f *filter.Filter) {
+	subject := f.Name() + " filter"
+
+	d.l.Debugf("Checking the %s filter", f.Name())
+	if f.RequirementIsDeferred() {
+		d.add(Warn, subject, "The %s executable depends on the dir the filter runs in, so it can only be checked when the filter is run", f.Requires.Tool)
+		d.checkIgnoreFiles(subject, f.Ignore)
+		return
+	}
+
+	exe, version, err := f.CheckRequirement()
+	if err == nil && version == "" {
+		version, _ = f.ToolVersion()
+	}
+	if err != nil {
+		// A filter that is skipped when its tool is missing doesn't stop
+		// anything else from running.
+		if f.OnMissing == filter.OnMissingSkip {
+			d.add(Warn, subject, "%s (this filter will be skipped)", err)
+		} else {
+			d.add(Fail, subject, "%s", err)
+		}
+	} else if version != "" {
+		d.add(Pass, subject, "Found %s, version %s", exe, version)
+	} else {
+		d.add(Pass, subject, "Found %s (could not detect its version)", exe)
+	}
+
+	if err == nil && f.Server != nil {
+		err = f.Server.Probe(ServerTimeout)
+		if err != nil {
+			d.add(Fail, subject, "%s", err)
+		} else {
+			d.add(Pass, subject, "The server started and answered the initialize request on port %d", f.Server.Port)
+		}
+	}
+
+	d.checkIgnoreFiles(subject, f.Ignore)
+}
+
+func (d *Doctor) checkIgnoreFiles(subject string, files []string) {
+	for _, file := range files {
+		_, err := os.Stat(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				d.add(Fail, subject, "The ignore file %s does not exist", file)
+			} else {
+				d.add(Fail, subject, "Could not stat the ignore file %s: %s", file, err)
+			}
+			continue
+		}
+
+		err = gitignore.CompileFile(file)
+		if err != nil {
+			d.add(Fail, subject, "The ignore file %s could not be compiled: %s", file, err)
+			continue
+		}
+
+		d.add(Pass, subject, "The ignore file %s exists and compiles", file)
+	}
+}
+
+// The git modes are optional, so problems with them are only warnings.
+func (d *Doctor) checkGit() {
+	subject := "git modes"
+
+	exe, err := exec.LookPath("git")
+	if err != nil {
+		d.add(Warn, subject, "The git executable was not found in your PATH, so the -g and -s flags will not work")
+		return
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(exe, "rev-parse", "--show-toplevel")
+	cmd.Dir = d.c.Root()
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		d.add(Warn, subject, "%s is not in a git checkout, so the -g and -s flags will not work: %s", d.c.Root(), msg)
+		return
+	}
+
+	d.add(Pass, subject, "Found %s and a git checkout at %s", exe, strings.TrimSpace(stdout.String()))
+}
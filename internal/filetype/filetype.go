@@ -0,0 +1,299 @@
+package filetype
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	zglob "github.com/mattn/go-zglob"
+	"github.com/pkg/errors"
+)
+
+// Type describes how to recognize one kind of file.
+type Type struct {
+	Name string
+	// Extensions include the leading dot, like ".pl".
+	Extensions []string
+	// Filenames are exact basenames, like "Makefile".
+	Filenames []string
+	// Interpreters are matched against the program in a shebang line.
+	Interpreters []string
+	// Modes are matched against the mode in an Emacs modeline or the
+	// filetype in a Vim modeline.
+	Modes []string
+	// Globs are user-defined patterns. A glob without a slash is matched
+	// against the file's basename. Otherwise it is a zglob pattern matched
+	// against the whole path.
+	Globs []string
+}
+
+// Types are the built-in file types. A file is checked against each way of
+// recognizing a type in turn, so a file named "Makefile.pl" is Perl, not a
+// Makefile.
+var Types = []*Type{
+	{
+		Name:       "go",
+		Extensions: []string{".go"},
+		Modes:      []string{"go"},
+	},
+	{
+		Name:         "perl",
+		Extensions:   []string{".pl", ".pm", ".t", ".psgi"},
+		Filenames:    []string{"cpanfile"},
+		Interpreters: []string{"perl"},
+		Modes:        []string{"perl", "cperl"},
+	},
+	{
+		Name:         "python",
+		Extensions:   []string{".py", ".pyw"},
+		Interpreters: []string{"python", "python2", "python3"},
+		Modes:        []string{"python"},
+	},
+	{
+		Name:         "ruby",
+		Extensions:   []string{".rb", ".rake", ".gemspec"},
+		Filenames:    []string{"Gemfile", "Rakefile"},
+		Interpreters: []string{"ruby"},
+		Modes:        []string{"ruby"},
+	},
+	{
+		Name:         "javascript",
+		Extensions:   []string{".js", ".jsx", ".mjs", ".cjs"},
+		Interpreters: []string{"node", "nodejs"},
+		Modes:        []string{"js", "javascript"},
+	},
+	{
+		Name:         "typescript",
+		Extensions:   []string{".ts", ".tsx"},
+		Interpreters: []string{"ts-node", "deno"},
+		Modes:        []string{"typescript"},
+	},
+	{
+		Name:         "shell",
+		Extensions:   []string{".sh", ".bash", ".zsh", ".ksh"},
+		Filenames:    []string{".bashrc", ".bash_profile", ".profile", ".zshrc"},
+		Interpreters: []string{"sh", "bash", "dash", "ksh", "zsh"},
+		Modes:        []string{"sh", "shell-script", "bash", "zsh"},
+	},
+	{
+		Name:       "rust",
+		Extensions: []string{".rs"},
+		Modes:      []string{"rust"},
+	},
+	{
+		Name:       "make",
+		Extensions: []string{".mk", ".mak"},
+		Filenames:  []string{"Makefile", "makefile", "GNUmakefile"},
+		Modes:      []string{"make", "makefile", "makefile-gmake"},
+	},
+	{
+		Name:       "docker",
+		Extensions: []string{".dockerfile"},
+		Filenames:  []string{"Dockerfile", "Containerfile"},
+		Modes:      []string{"dockerfile"},
+	},
+}
+
+var builtin = NewRegistry()
+
+// Lookup returns the built-in type with the given name, or nil if there isn't
+// one.
+func Lookup(name string) *Type {
+	return builtin.Lookup(name)
+}
+
+// Names returns the names of all the built-in types.
+func Names() []string {
+	return builtin.Names()
+}
+
+// Detect returns the built-in type of the file at path, or nil if its type is
+// not known. The second return value is true if the type was detected from
+// the file's content rather than its name.
+func Detect(path string) (*Type, bool, error) {
+	return builtin.Detect(path)
+}
+
+// ShebangInterpreter returns the name of the program in a shebang line. For
+// "#!/usr/bin/env perl" this is "perl", not "env". A trailing version number
+// is left alone, so "python3" is returned as is.
+func ShebangInterpreter(line string) string {
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interp := filepath.Base(fields[0])
+	if interp == "env" {
+		interp = ""
+		for _, f := range fields[1:] {
+			// env -S splits its argument, and other flags or VAR=val
+			// assignments come before the program.
+			if strings.HasPrefix(f, "-") || strings.Contains(f, "=") {
+				continue
+			}
+			interp = filepath.Base(f)
+			break
+		}
+	}
+
+	return interp
+}
+
+var (
+	emacsModeRE   = regexp.MustCompile(`-\*-\s*(?:.*?\bmode:\s*([\w+-]+).*?|([\w+-]+))\s*-\*-`)
+	vimModelineRE = regexp.MustCompile(`(?:^|\s)(?:vi|vim|ex):\s*(?:set?\s+)?.*?\b(?:ft|filetype|syntax|syn)=([\w+-]+)`)
+)
+
+// modeline returns the mode from an Emacs modeline like "-*- mode: perl -*-"
+// or "-*- perl -*-", or the filetype from a Vim modeline like
+// "vim: set ft=sh:". The mode is lower-cased and any "-mode" suffix is
+// removed.
+func modeline(line string) string {
+	mode := ""
+	if m := emacsModeRE.FindStringSubmatch(line); m != nil {
+		mode = m[1]
+		if mode == "" {
+			mode = m[2]
+		}
+	} else if m := vimModelineRE.FindStringSubmatch(line); m != nil {
+		mode = m[1]
+	}
+
+	return strings.TrimSuffix(strings.ToLower(mode), "-mode")
+}
+
+// How many lines at the start and end of a file to check for modelines. Vim
+// checks five lines at each end by default. Emacs only looks at the first
+// line, or the second if the first is a shebang.
+const modelineLines = 5
+
+// We only need to look at a few lines at either end of the file, so we don't
+// read the whole thing. Directories and files that look binary return no
+// lines.
+func interestingLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not open %s", path))
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not stat %s", path))
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	const chunk = 8192
+	head := make([]byte, chunk)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not read %s", path))
+	}
+	head = head[:n]
+	if bytes.IndexByte(head, 0) != -1 {
+		return nil, nil
+	}
+
+	lines := firstLines(head, modelineLines)
+	if n < chunk {
+		return append(lines, lastLines(head, modelineLines)...), nil
+	}
+
+	start := fi.Size() - chunk
+	if start < chunk {
+		start = chunk
+	}
+	tail := make([]byte, fi.Size()-start)
+	_, err = f.ReadAt(tail, start)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not read %s", path))
+	}
+
+	return append(lines, lastLines(tail, modelineLines)...), nil
+}
+
+func firstLines(b []byte, n int) []string {
+	lines := []string{}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for len(lines) < n && s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	return lines
+}
+
+func lastLines(b []byte, n int) []string {
+	all := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if len(all) > n {
+		all = all[len(all)-n:]
+	}
+	return all
+}
+
+func (t *Type) matchesName(path string) (bool, error) {
+	base := filepath.Base(path)
+	if contains(t.Filenames, base) {
+		return true, nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(base))
+	if ext != "" && contains(t.Extensions, ext) {
+		return true, nil
+	}
+
+	for _, g := range t.Globs {
+		var matched bool
+		var err error
+		if strings.Contains(g, "/") {
+			matched, err = zglob.Match(g, path)
+		} else {
+			matched, err = filepath.Match(g, base)
+		}
+		if err != nil {
+			return false, errors.Wrap(err, fmt.Sprintf("Error matching %s against the %s type's pattern %s", path, t.Name, g))
+		}
+		if matched {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (t *Type) matchesContent(lines []string) bool {
+	if len(lines) == 0 {
+		return false
+	}
+
+	if interp := ShebangInterpreter(lines[0]); interp != "" && contains(t.Interpreters, interp) {
+		return true
+	}
+
+	for _, l := range lines {
+		if mode := modeline(l); mode != "" && contains(t.Modes, mode) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(vals []string, v string) bool {
+	for _, s := range vals {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package filetype
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Registry is a set of named types. It starts with the built-in types, and
+// the config can add new types or add globs to existing ones.
+type Registry struct {
+	types []*Type
+}
+
+func NewRegistry() *Registry {
+	r := &Registry{}
+	for _, t := range Types {
+		c := *t
+		r.types = append(r.types, &c)
+	}
+	return r
+}
+
+var typeNameRE = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Add adds globs to the named type, creating the type if it doesn't exist.
+func (r *Registry) Add(name string, globs []string) error {
+	if !typeNameRE.MatchString(name) {
+		return errors.Errorf(
+			"The type name %q is not valid. Type names must contain only lower case letters, digits, underscores, and dashes.", name)
+	}
+
+	for _, g := range globs {
+		if strings.Contains(g, "/") {
+			continue
+		}
+		_, err := filepath.Match(g, "")
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("The pattern %q for the %s type is not valid", g, name))
+		}
+	}
+
+	if t := r.Lookup(name); t != nil {
+		t.Globs = append(append([]string{}, t.Globs...), globs...)
+		return nil
+	}
+
+	r.types = append(r.types, &Type{Name: name, Globs: globs})
+	return nil
+}
+
+// Lookup returns the type with the given name, or nil if there isn't one.
+func (r *Registry) Lookup(name string) *Type {
+	for _, t := range r.types {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Names returns the names of all the types, sorted.
+func (r *Registry) Names() []string {
+	names := []string{}
+	for _, t := range r.types {
+		names = append(names, t.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Types returns all the types, sorted by name.
+func (r *Registry) Types() []*Type {
+	types := append([]*Type{}, r.types...)
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Name < types[j].Name
+	})
+	return types
+}
+
+// Detect returns the first type that matches the file at path, or nil if no
+// type matches. Types are checked by name before content. The second return
+// value is true if the type was detected from the file's content.
+func (r *Registry) Detect(path string) (*Type, bool, error) {
+	for _, t := range r.types {
+		matched, err := t.matchesName(path)
+		if err != nil {
+			return nil, false, err
+		}
+		if matched {
+			return t, false, nil
+		}
+	}
+
+	lines, err := interestingLines(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, t := range r.types {
+		if t.matchesContent(lines) {
+			return t, true, nil
+		}
+	}
+
+	return nil, false, nil
+}
+
+// Matches returns true if the file at path is of the named type. Unlike
+// Detect, this checks only the named type, so a file can match more than one
+// type. It is an error if there is no type with the given name.
+func (r *Registry) Matches(path, name string) (bool, error) {
+	return r.MatchesAs(path, path, name)
+}
+
+// MatchesAs is like Matches, except that the file's content is read from
+// contentPath. This is used for content that is not at its real path, like
+// content read from stdin.
+func (r *Registry) MatchesAs(path, contentPath, name string) (bool, error) {
+	t := r.Lookup(name)
+	if t == nil {
+		return false, errors.Errorf("There is no file type named %s", name)
+	}
+
+	matched, err := t.matchesName(path)
+	if err != nil || matched {
+		return matched, err
+	}
+
+	if len(t.Interpreters) == 0 && len(t.Modes) == 0 {
+		return false, nil
+	}
+
+	lines, err := interestingLines(contentPath)
+	if err != nil {
+		return false, err
+	}
+
+	return t.matchesContent(lines), nil
+}
+
+// Describe returns a summary of how the type is matched, in the style of
+// ripgrep's --type-list.
+func (t *Type) Describe() string {
+	parts := []string{}
+	for _, e := range t.Extensions {
+		parts = append(parts, "*"+e)
+	}
+	parts = append(parts, t.Filenames...)
+	parts = append(parts, t.Globs...)
+	for _, i := range t.Interpreters {
+		parts = append(parts, "#!"+i)
+	}
+	for _, m := range t.Modes {
+		parts = append(parts, "mode:"+m)
+	}
+	return strings.Join(parts, ", ")
+}
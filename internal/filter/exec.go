@@ -0,0 +1,421 @@
+package filter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/houseabsolute/precious/internal/interpolate"
+	"github.com/pkg/errors"
+)
+
+// Invocation is a single execution of a command filter.
+type Invocation struct {
+	Argv  []string
+	Dir   string
+	Paths []string
+	// These are the filter's env and path_prepend with the per-invocation
+	// placeholders replaced.
+	env         map[string]string
+	pathPrepend []string
+}
+
+// Result is the outcome of running one Invocation. If the invocation timed
+// out, TimedOut is true and the exit code is meaningless. If the command
+// could not be run at all, Err is set. If it was not run because its tool is
+// missing and the filter has on_missing = "skip", Skipped is set as well.
+// Attempts is the number of times the invocation was run, which is only more
+// than one if the filter has retries. If the invocation was stopped because
+// we were cancelled, Interrupted is true.
+type Result struct {
+	*Invocation
+	ExitCode    int
+	Stdout      string
+	Stderr      string
+	TimedOut    bool
+	Skipped     bool
+	Interrupted bool
+	Err         error
+	Attempts    int
+}
+
+// GracePeriod is how long a filter has to exit after it is sent SIGTERM
+// before it is killed.
+const GracePeriod = 5 * time.Second
+
+type killKey struct{}
+
+// WithKill returns a context that makes running commands skip the grace
+// period. Once kill is closed, any command that was told to stop is killed
+// immediately.
+func WithKill(ctx context.Context, kill <-chan struct{}) context.Context {
+	return context.WithValue(ctx, killKey{}, kill)
+}
+
+// A nil channel blocks forever, so without WithKill we always wait for the
+// whole grace period.
+func killChan(ctx context.Context) <-chan struct{} {
+	kill, _ := ctx.Value(killKey{}).(<-chan struct{})
+	return kill
+}
+
+// Run executes a command filter against the given paths. Depending on the
+// filter's args and working dir this may be more than one invocation of the
+// command. If the context is cancelled, any running command is terminated
+// and Run returns the results it has so far along with the context's error.
+// The last of these results is the interrupted invocation, if a command was
+// running at the time.
+func (f *Filter) Run(ctx context.Context, paths []string) ([]*Result, error) {
+	invs, err := f.invocations(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*Result{}
+	for _, inv := range invs {
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+
+		if f.RequirementIsDeferred() {
+			err := f.checkDeferredRequirement(inv.Dir, prependDirs(inv.Dir, inv.pathPrepend))
+			if err != nil {
+				results = append(results, &Result{
+					Invocation: inv,
+					Err:        err,
+					Skipped:    f.OnMissing == OnMissingSkip,
+				})
+				continue
+			}
+		}
+
+		r, err := f.run(ctx, inv)
+		if r != nil {
+			results = append(results, r)
+		}
+		if err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// Tidy and Lint both run the filter's command. Whether the results are
+// treated as tidying or linting is up to the caller.
+func (f *Filter) Tidy(ctx context.Context, paths []string) ([]*Result, error) {
+	return f.Run(ctx, paths)
+}
+
+func (f *Filter) Lint(ctx context.Context, paths []string) ([]*Result, error) {
+	return f.Run(ctx, paths)
+}
+
+func (f *Filter) invocations(paths []string) ([]*Invocation, error) {
+	argv := append(append([]string{}, f.Cmd...), f.Args...)
+	perPath := interpolate.IsPerPath(argv) ||
+		interpolate.IsPerPath(f.envValues()) ||
+		interpolate.IsPerPath(f.PathPrepend)
+
+	dirs := []string{}
+	byDir := map[string][]string{}
+	for _, p := range paths {
+		dir, err := f.WorkingDir.Resolve(f.Root, f.ConfigDir, p)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Could not determine the working dir for the %s filter", f.name))
+		}
+		if _, ok := byDir[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], p)
+	}
+
+	invs := []*Invocation{}
+	for _, dir := range dirs {
+		targets, err := f.targets(byDir[dir])
+		if err != nil {
+			return nil, err
+		}
+		if perPath {
+			for _, t := range targets {
+				invs = append(invs, f.invocation(argv, dir, []target{t}))
+			}
+			continue
+		}
+		invs = append(invs, f.invocation(argv, dir, targets))
+	}
+
+	return invs, nil
+}
+
+// A target is an absolute path that is passed to the command, along with the
+// paths that it covers. With on_dir, each target is a directory that covers
+// the paths in it. Otherwise each path is its own target.
+type target struct {
+	path   string
+	covers []string
+}
+
+func (f *Filter) targets(paths []string) ([]target, error) {
+	targets := []target{}
+	byDir := map[string]int{}
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Could not get abs path for %s", p))
+		}
+
+		if !f.OnDir {
+			targets = append(targets, target{abs, []string{p}})
+			continue
+		}
+
+		dir := filepath.Dir(abs)
+		if i, ok := byDir[dir]; ok {
+			targets[i].covers = append(targets[i].covers, p)
+			continue
+		}
+		byDir[dir] = len(targets)
+		targets = append(targets, target{dir, []string{p}})
+	}
+
+	return targets, nil
+}
+
+// The paths we are given may be relative to the current directory, which is
+// not necessarily the directory the command runs in, so we pass them to the
+// command relative to its own directory.
+func (f *Filter) invocation(argv []string, dir string, targets []target) *Invocation {
+	args := []string{}
+	covers := []string{}
+	for _, t := range targets {
+		args = append(args, relativeTo(dir, t.path))
+		covers = append(covers, t.covers...)
+	}
+
+	if interpolate.HasPlaceholder(argv) {
+		argv = interpolate.ForInvocation(argv, f.Root, dir, args)
+	} else {
+		if f.Command != nil && f.Command.PathFlag != "" {
+			argv = append(argv, f.Command.PathFlag)
+		}
+		argv = append(argv, args...)
+	}
+
+	env := map[string]string{}
+	for k, v := range f.Env {
+		env[k] = interpolate.ForValue(v, f.Root, dir, args)
+	}
+	pathPrepend := []string{}
+	for _, p := range f.PathPrepend {
+		pathPrepend = append(pathPrepend, interpolate.ForValue(p, f.Root, dir, args))
+	}
+
+	return &Invocation{
+		Argv:        argv,
+		Dir:         dir,
+		Paths:       covers,
+		env:         env,
+		pathPrepend: pathPrepend,
+	}
+}
+
+func (f *Filter) envValues() []string {
+	vals := []string{}
+	for _, v := range f.Env {
+		vals = append(vals, v)
+	}
+	return vals
+}
+
+func relativeTo(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+func (f *Filter) run(ctx context.Context, inv *Invocation) (*Result, error) {
+	for attempt := 1; ; attempt++ {
+		r, err := f.runOnce(ctx, inv)
+		r.Attempts = attempt
+		if err != nil {
+			return r, err
+		}
+		if !r.TimedOut || attempt > f.Retries {
+			return r, nil
+		}
+	}
+}
+
+// We run each command in its own process group so that we can terminate any
+// children it started along with it when it times out or we are cancelled.
+// Otherwise a child holding on to stdout would keep us waiting even after
+// the command itself exited. This also means that a Ctrl-C in the terminal
+// is not delivered to the command directly, so we always pass it along.
+func (f *Filter) runOnce(ctx context.Context, inv *Invocation) (*Result, error) {
+	pathDirs := prependDirs(inv.Dir, inv.pathPrepend)
+
+	r := &Result{Invocation: inv}
+
+	exe, err := lookPath(inv.Argv[0], inv.Dir, pathDirs)
+	if err != nil {
+		r.Err = errors.Wrap(err, fmt.Sprintf("Could not find the executable for the %s filter", f.name))
+		return r, nil
+	}
+
+	cmd := exec.Command(exe, inv.Argv[1:]...)
+	cmd.Dir = inv.Dir
+	cmd.Env = environ(inv.env, pathDirs)
+	setProcessGroup(cmd)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	runCtx := ctx
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		r.Err = errors.Wrap(err, fmt.Sprintf("Could not run %s", strings.Join(inv.Argv, " ")))
+		return r, nil
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-runCtx.Done():
+			terminateProcessGroup(cmd)
+			select {
+			case <-done:
+			case <-time.After(GracePeriod):
+				killProcessGroup(cmd)
+			case <-killChan(ctx):
+				killProcessGroup(cmd)
+			}
+		case <-done:
+		}
+	}()
+
+	err = cmd.Wait()
+	close(done)
+	<-stopped
+
+	if ctx.Err() != nil {
+		r.Interrupted = true
+		return r, ctx.Err()
+	}
+
+	if runCtx.Err() != nil {
+		r.TimedOut = true
+		r.ExitCode = -1
+	} else if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			r.ExitCode = exitErr.ExitCode()
+		} else {
+			r.Err = errors.Wrap(err, fmt.Sprintf("Could not run %s", strings.Join(inv.Argv, " ")))
+		}
+	}
+
+	r.Stdout = stdout.String()
+	r.Stderr = stderr.String()
+
+	return r, nil
+}
+
+// Relative entries in path_prepend are relative to the directory the command
+// is run from, so that something like "node_modules/.bin" works with a
+// working_dir of "nearest:package.json".
+func (f *Filter) pathPrependFor(dir string) []string {
+	return prependDirs(dir, f.PathPrepend)
+}
+
+func prependDirs(dir string, entries []string) []string {
+	dirs := []string{}
+	for _, p := range entries {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		dirs = append(dirs, p)
+	}
+	return dirs
+}
+
+func environ(vars map[string]string, pathDirs []string) []string {
+	env := []string{}
+	for _, e := range os.Environ() {
+		name := strings.SplitN(e, "=", 2)[0]
+		if _, ok := vars[name]; ok {
+			continue
+		}
+		if name == "PATH" && len(pathDirs) > 0 {
+			continue
+		}
+		env = append(env, e)
+	}
+
+	for k, v := range vars {
+		if k == "PATH" && len(pathDirs) > 0 {
+			continue
+		}
+		env = append(env, k+"="+v)
+	}
+
+	if len(pathDirs) > 0 {
+		path := os.Getenv("PATH")
+		if p, ok := vars["PATH"]; ok {
+			path = p
+		}
+		env = append(env, "PATH="+strings.Join(append(pathDirs, path), string(filepath.ListSeparator)))
+	}
+
+	return env
+}
+
+// The exec package always looks up executables using our own PATH, so we
+// need to check the prepended dirs ourselves. A name with a path separator is
+// not looked up at all. If it's relative, it's relative to dir, which is
+// where the command will run.
+func lookPath(name, dir string, dirs []string) (string, error) {
+	if strings.ContainsRune(name, filepath.Separator) {
+		p := name
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		if !isExecutable(p) {
+			return "", errors.Errorf("The %s executable does not exist or is not executable.", p)
+		}
+		return p, nil
+	}
+
+	for _, d := range dirs {
+		p := filepath.Join(d, name)
+		if isExecutable(p) {
+			return p, nil
+		}
+	}
+
+	p, err := exec.LookPath(name)
+	if err != nil {
+		return "", errors.Errorf("The %s executable was not found in your PATH. You need to install it or add its directory to your PATH.", name)
+	}
+	return p, nil
+}
+
+func isExecutable(p string) bool {
+	fi, err := os.Stat(p)
+	return err == nil && !fi.IsDir() && fi.Mode()&0111 != 0
+}
@@ -1,16 +1,40 @@
 package filter
 
+import (
+	"context"
+	"time"
+
+	"github.com/houseabsolute/precious/internal/filetype"
+	"github.com/houseabsolute/precious/internal/skip"
+)
+
 type Filter struct {
-	name    string
-	Ignore  []string
-	Include []string
-	Exclude []string
-	Type    FilterType
-	Cmd     []string
-	Args    []string
-	OnDir   bool
-	Server  *Server
-	Command *Command
+	name         string
+	Ignore       []string
+	Include      []string
+	IncludeTypes []string
+	Types        *filetype.Registry
+	Exclude      []string
+	Type         FilterType
+	Cmd          []string
+	Args         []string
+	OnDir        bool
+	Env          map[string]string
+	PathPrepend  []string
+	WorkingDir   WorkingDir
+	Root         string
+	ConfigDir    string
+	Requires     *Requirement
+	OnMissing    OnMissing
+	Timeout      time.Duration
+	Retries      int
+	Skip         skip.Rules
+	IssueRegex   string
+	Server       *Server
+	Command      *Command
+	// This caches the result of checking a deferred requirement in each
+	// dir the filter has run in.
+	checkedDirs map[string]error
 }
 
 type Server struct {
@@ -21,40 +45,78 @@ type Server struct {
 
 type Command struct {
 	*Filter
-	PathFlag    string
-	OkExitCodes []int
+	PathFlag             string
+	OkExitCodes          []int
+	LintFailureExitCodes []int
+	StderrIsFailure      bool
 }
 
 type Tidier interface {
-	Tidy(string) (string, error)
+	Tidy(context.Context, []string) ([]*Result, error)
 }
 
 type Linter interface {
-	Lint(string) (string, error)
+	Lint(context.Context, []string) ([]*Result, error)
 }
 
 func NewServer(
 	name string,
 	ignore, include, exclude []string,
 	typ FilterType,
-	cmd string,
+	cmd []string,
 	args []string,
 	onDir bool,
 	port int,
 	persistent bool,
 ) *Filter {
-	return &Filter{}
+	f := newFilter(name, ignore, include, exclude, typ, cmd, args, onDir)
+	f.Server = &Server{
+		Filter:     f,
+		Port:       port,
+		Persistent: persistent,
+	}
+	return f
 }
 
 func NewCommand(
 	name string,
 	ignore, include, exclude []string,
 	typ FilterType,
-	cmd string,
+	cmd []string,
 	args []string,
 	onDir bool,
 	pathFlag string,
 	okExitCodes []int,
 ) *Filter {
-	return &Filter{}
+	f := newFilter(name, ignore, include, exclude, typ, cmd, args, onDir)
+	f.Command = &Command{
+		Filter:      f,
+		PathFlag:    pathFlag,
+		OkExitCodes: okExitCodes,
+	}
+	return f
+}
+
+func newFilter(
+	name string,
+	ignore, include, exclude []string,
+	typ FilterType,
+	cmd []string,
+	args []string,
+	onDir bool,
+) *Filter {
+	return &Filter{
+		name:    name,
+		Ignore:  ignore,
+		Include: include,
+		Exclude: exclude,
+		Type:    typ,
+		Cmd:     cmd,
+		Args:    args,
+		OnDir:   onDir,
+	}
+}
+
+func (f *Filter) Name() string {
+	return f.name
 }
@@ -8,6 +8,7 @@ type FilterType int
 const (
 	Lint FilterType = iota
 	Tidy
+	Both
 )
 
 // There's a circular issues with this method. The enumer code generates
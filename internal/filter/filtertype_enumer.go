@@ -6,9 +6,9 @@ import (
 	"fmt"
 )
 
-const _FilterTypeName = "LintTidy"
+const _FilterTypeName = "LintTidyBoth"
 
-var _FilterTypeIndex = [...]uint8{0, 4, 8}
+var _FilterTypeIndex = [...]uint8{0, 4, 8, 12}
 
 func (i FilterType) String() string {
 	if i < 0 || i >= FilterType(len(_FilterTypeIndex)-1) {
@@ -17,11 +17,12 @@ func (i FilterType) String() string {
 	return _FilterTypeName[_FilterTypeIndex[i]:_FilterTypeIndex[i+1]]
 }
 
-var _FilterTypeValues = []FilterType{0, 1}
+var _FilterTypeValues = []FilterType{0, 1, 2}
 
 var _FilterTypeNameToValueMap = map[string]FilterType{
-	_FilterTypeName[0:4]: 0,
-	_FilterTypeName[4:8]: 1,
+	_FilterTypeName[0:4]:  0,
+	_FilterTypeName[4:8]:  1,
+	_FilterTypeName[8:12]: 2,
 }
 
 // FilterTypeString retrieves an enum value from the enum constants string name.
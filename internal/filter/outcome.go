@@ -0,0 +1,77 @@
+package filter
+
+import (
+	"strings"
+)
+
+type Outcome int
+
+// These are ordered by severity, so the outcome of a run with many results
+// is the largest outcome of any of them.
+const (
+	// Passed means the command succeeded.
+	Passed Outcome = iota
+	// Failed means the command ran correctly and found a problem with the
+	// code, like a lint violation.
+	Failed
+	// Errored means the command itself did not work. It could not be
+	// started, timed out, was killed, or exited with an unexpected code.
+	Errored
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Passed:
+		return "passed"
+	case Failed:
+		return "failed"
+	}
+	return "errored"
+}
+
+// Classify decides the outcome of a result based on the command's
+// ok_exit_codes, lint_failure_exit_codes, and stderr_is_failure settings. If
+// ok_exit_codes is not set, only 0 is ok. If lint_failure_exit_codes is not
+// set, any other exit code is a lint failure, but a command that was killed
+// by a signal is always an error. A result that was skipped always passes.
+func (f *Filter) Classify(r *Result) Outcome {
+	if r.Skipped {
+		return Passed
+	}
+	if r.Err != nil || r.TimedOut || r.ExitCode < 0 {
+		return Errored
+	}
+
+	var okCodes, failureCodes []int
+	stderrIsFailure := false
+	if f.Command != nil {
+		okCodes = f.Command.OkExitCodes
+		failureCodes = f.Command.LintFailureExitCodes
+		stderrIsFailure = f.Command.StderrIsFailure
+	}
+	if len(okCodes) == 0 {
+		okCodes = []int{0}
+	}
+
+	if containsInt(okCodes, r.ExitCode) {
+		if stderrIsFailure && strings.TrimSpace(r.Stderr) != "" {
+			return Failed
+		}
+		return Passed
+	}
+
+	if len(failureCodes) == 0 || containsInt(failureCodes, r.ExitCode) {
+		return Failed
+	}
+
+	return Errored
+}
+
+func containsInt(vals []int, v int) bool {
+	for _, i := range vals {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
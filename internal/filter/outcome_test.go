@@ -0,0 +1,97 @@
+package filter
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name    string
+		command *Command
+		result  Result
+		want    Outcome
+	}{
+		{
+			name:   "zero is ok by default",
+			result: Result{ExitCode: 0},
+			want:   Passed,
+		},
+		{
+			name:   "any other code is a failure by default",
+			result: Result{ExitCode: 3},
+			want:   Failed,
+		},
+		{
+			name:    "ok_exit_codes",
+			command: &Command{OkExitCodes: []int{0, 1}},
+			result:  Result{ExitCode: 1},
+			want:    Passed,
+		},
+		{
+			name:    "zero is not ok if ok_exit_codes leaves it out",
+			command: &Command{OkExitCodes: []int{1}},
+			result:  Result{ExitCode: 0},
+			want:    Failed,
+		},
+		{
+			name:    "lint_failure_exit_codes",
+			command: &Command{LintFailureExitCodes: []int{1}},
+			result:  Result{ExitCode: 1},
+			want:    Failed,
+		},
+		{
+			name:    "code not in lint_failure_exit_codes",
+			command: &Command{LintFailureExitCodes: []int{1}},
+			result:  Result{ExitCode: 2},
+			want:    Errored,
+		},
+		{
+			name:    "stderr_is_failure with stderr",
+			command: &Command{StderrIsFailure: true},
+			result:  Result{ExitCode: 0, Stderr: "warning: x\n"},
+			want:    Failed,
+		},
+		{
+			name:    "stderr_is_failure with blank stderr",
+			command: &Command{StderrIsFailure: true},
+			result:  Result{ExitCode: 0, Stderr: " \n"},
+			want:    Passed,
+		},
+		{
+			name:   "stderr is ignored without stderr_is_failure",
+			result: Result{ExitCode: 0, Stderr: "warning: x\n"},
+			want:   Passed,
+		},
+		{
+			name:   "tool error",
+			result: Result{Err: errors.New("Could not find the executable")},
+			want:   Errored,
+		},
+		{
+			name:   "skipped tool",
+			result: Result{Err: errors.New("Could not find the executable"), Skipped: true},
+			want:   Passed,
+		},
+		{
+			name:   "timed out",
+			result: Result{TimedOut: true, ExitCode: -1},
+			want:   Errored,
+		},
+		{
+			name:   "killed by a signal",
+			result: Result{ExitCode: -1},
+			want:   Errored,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := &Filter{Command: test.command}
+			r := test.result
+			if got := f.Classify(&r); got != test.want {
+				t.Errorf("Classify() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
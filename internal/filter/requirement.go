@@ -0,0 +1,274 @@
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type OnMissing int
+
+const (
+	// OnMissingError makes a missing or too old tool an error.
+	OnMissingError OnMissing = iota
+	// OnMissingSkip skips the filter with a warning instead.
+	OnMissingSkip
+)
+
+// ParseOnMissing parses the value of a filter's on_missing key. An empty
+// string is treated as "error".
+func ParseOnMissing(s string) (OnMissing, error) {
+	switch s {
+	case "", "error":
+		return OnMissingError, nil
+	case "skip":
+		return OnMissingSkip, nil
+	}
+	return OnMissingError, errors.Errorf(`The on_missing value %q must be either "error" or "skip"`, s)
+}
+
+// Requirement is a tool that a filter needs, optionally with a version
+// constraint, as in "golangci-lint >= 1.20".
+type Requirement struct {
+	Tool         string
+	Op           string
+	Version      string
+	VersionCmd   []string
+	VersionRegex *regexp.Regexp
+}
+
+var defaultVersionRegex = regexp.MustCompile(`(\d+(?:\.\d+)+)`)
+
+var requiresRE = regexp.MustCompile(`^\s*(\S+)(?:\s*(>=|<=|==|!=|=|>|<)\s*(\d+(?:\.\d+)*))?\s*$`)
+
+// NewRequirement returns a requirement for the tool without a version
+// constraint. The tool may contain spaces, since it's not parsed.
+func NewRequirement(tool string, versionCmd []string) *Requirement {
+	r := &Requirement{
+		Tool:         tool,
+		VersionCmd:   versionCmd,
+		VersionRegex: defaultVersionRegex,
+	}
+	if len(r.VersionCmd) == 0 {
+		r.VersionCmd = []string{r.Tool, "--version"}
+	}
+	return r
+}
+
+// ParseRequirement parses a requires value. The versionCmd defaults to
+// running the tool with --version, and versionRegex defaults to matching the
+// first dotted version number in the output. If the regex has a capture
+// group, the first group is used as the version.
+func ParseRequirement(s string, versionCmd []string, versionRegex string) (*Requirement, error) {
+	m := requiresRE.FindStringSubmatch(s)
+	if m == nil {
+		return nil, errors.Errorf(`The requirement %q must look like "tool" or "tool >= 1.2.3"`, s)
+	}
+
+	r := NewRequirement(m[1], versionCmd)
+	r.Op = m[2]
+	r.Version = m[3]
+
+	if versionRegex != "" {
+		re, err := regexp.Compile(versionRegex)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("The version regex %q is not valid", versionRegex))
+		}
+		r.VersionRegex = re
+	}
+
+	return r, nil
+}
+
+func (r *Requirement) String() string {
+	if r.Op == "" {
+		return r.Tool
+	}
+	return fmt.Sprintf("%s %s %s", r.Tool, r.Op, r.Version)
+}
+
+// Check looks for the tool in the given dirs and then the PATH. A tool with
+// a relative path is relative to dir, which is also where the version command
+// is run. It returns the path to the executable and its version, if the
+// requirement has a version constraint. The error explains what the user
+// needs to do to fix the problem.
+func (r *Requirement) Check(dir string, pathDirs []string) (string, string, error) {
+	exe, err := lookPath(r.Tool, dir, pathDirs)
+	if err != nil {
+		return "", "", err
+	}
+
+	if r.Op == "" {
+		return exe, "", nil
+	}
+
+	version, err := r.FindVersion(dir, pathDirs)
+	if err != nil {
+		return exe, "", err
+	}
+
+	if !compareVersions(version, r.Op, r.Version) {
+		return exe, version, errors.Errorf(
+			"The %s executable at %s is version %s but this filter requires %s. You need to install a compatible version.",
+			r.Tool, exe, version, r.String())
+	}
+
+	return exe, version, nil
+}
+
+// FindVersion runs the version command and extracts the version from its
+// output.
+func (r *Requirement) FindVersion(dir string, pathDirs []string) (string, error) {
+	exe, err := lookPath(r.VersionCmd[0], dir, pathDirs)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("Could not get the version of %s", r.Tool))
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command(exe, r.VersionCmd[1:]...)
+	cmd.Dir = dir
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err = cmd.Run()
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("Could not run %s to get the version of %s", strings.Join(r.VersionCmd, " "), r.Tool))
+	}
+
+	m := r.VersionRegex.FindStringSubmatch(out.String())
+	if m == nil {
+		return "", errors.Errorf(
+			"Could not find a version in the output of %s using the regex %s", strings.Join(r.VersionCmd, " "), r.VersionRegex)
+	}
+	if len(m) > 1 {
+		return m[1], nil
+	}
+
+	return m[0], nil
+}
+
+func compareVersions(have, op, want string) bool {
+	c := cmpVersions(have, want)
+	switch op {
+	case ">=":
+		return c >= 0
+	case ">":
+		return c > 0
+	case "<=":
+		return c <= 0
+	case "<":
+		return c < 0
+	case "!=":
+		return c != 0
+	}
+	return c == 0
+}
+
+// Versions are compared one dot-separated number at a time, with missing
+// parts treated as 0, so 1.20 is the same as 1.20.0.
+func cmpVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		an := versionPart(as, i)
+		bn := versionPart(bs, i)
+		if an < bn {
+			return -1
+		}
+		if an > bn {
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionPart(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+	n, err := strconv.Atoi(parts[i])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// RequirementIsDeferred returns true if the filter's tool can only be found
+// once we know which directory the command runs in. This is the case when the
+// working dir depends on the file being filtered and the tool is found
+// through a relative path_prepend dir or has a relative path itself. These
+// filters check their requirement each time they run in a new directory.
+func (f *Filter) RequirementIsDeferred() bool {
+	if !f.WorkingDir.IsPerFile() || f.Requires == nil {
+		return false
+	}
+
+	for _, d := range f.PathPrepend {
+		if !filepath.IsAbs(d) {
+			return true
+		}
+	}
+	return isRelativePath(f.Requires.Tool) || isRelativePath(f.Requires.VersionCmd[0])
+}
+
+// CheckRequirement checks that the filter's tool is installed and meets its
+// version constraint. It returns the path to the executable and its version,
+// if the requirement has a version constraint. This should not be called for
+// a filter where RequirementIsDeferred is true.
+func (f *Filter) CheckRequirement() (string, string, error) {
+	if f.Requires == nil {
+		return "", "", errors.Errorf("The %s filter does not have a cmd", f.name)
+	}
+
+	dir := f.requirementDir()
+	return f.Requires.Check(dir, f.pathPrependFor(dir))
+}
+
+// ToolVersion returns the version of the filter's tool, even if the filter
+// does not have a version constraint.
+func (f *Filter) ToolVersion() (string, error) {
+	if f.Requires == nil {
+		return "", errors.Errorf("The %s filter does not have a cmd", f.name)
+	}
+
+	dir := f.requirementDir()
+	return f.Requires.FindVersion(dir, f.pathPrependFor(dir))
+}
+
+// For a filter with a per-file working dir, this is only right if the
+// requirement is not deferred, in which case the dir doesn't matter.
+func (f *Filter) requirementDir() string {
+	if f.WorkingDir.Kind == WorkingDirConfig {
+		return f.ConfigDir
+	}
+	return f.Root
+}
+
+// The result is cached for each dir and PATH, since a filter may be run in
+// the same dir many times. The PATH only differs between invocations if
+// path_prepend has per-path placeholders.
+func (f *Filter) checkDeferredRequirement(dir string, pathDirs []string) error {
+	if f.checkedDirs == nil {
+		f.checkedDirs = map[string]error{}
+	}
+	key := strings.Join(append([]string{dir}, pathDirs...), string(filepath.ListSeparator))
+	if err, ok := f.checkedDirs[key]; ok {
+		return err
+	}
+
+	_, _, err := f.Requires.Check(dir, pathDirs)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("The %s filter cannot be run in %s", f.name, dir))
+	}
+	f.checkedDirs[key] = err
+	return err
+}
+
+func isRelativePath(name string) bool {
+	return strings.ContainsRune(name, filepath.Separator) && !filepath.IsAbs(name)
+}
@@ -0,0 +1,147 @@
+package filter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Probe starts the server, connects to its port, and sends an LSP
+// initialize request. It returns an error if the server cannot be started or
+// does not answer the request within the timeout. The server is killed once
+// the probe is done.
+func (s *Server) Probe(timeout time.Duration) error {
+	if len(s.Cmd) == 0 {
+		return errors.Errorf("The %s server does not have a cmd", s.name)
+	}
+
+	pathDirs := s.pathPrependFor(s.Root)
+	exe, err := lookPath(s.Cmd[0], s.Root, pathDirs)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Could not find the executable for the %s server", s.name))
+	}
+
+	cmd := exec.Command(exe, append(append([]string{}, s.Cmd[1:]...), s.Args...)...)
+	cmd.Dir = s.Root
+	cmd.Env = environ(s.Env, pathDirs)
+	err = cmd.Start()
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Could not start the %s server", s.name))
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	deadline := time.Now().Add(timeout)
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(s.Port))
+
+	var conn net.Conn
+	for {
+		conn, err = net.DialTimeout("tcp", addr, time.Until(deadline))
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return errors.Wrap(err, fmt.Sprintf("Could not connect to the %s server at %s", s.name, addr))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return errors.Wrap(err, "Could not set a deadline on the server connection")
+	}
+
+	return s.initialize(conn)
+}
+
+func (s *Server) initialize(conn net.Conn) error {
+	req, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "initialize",
+		"params": map[string]interface{}{
+			"processId":    os.Getpid(),
+			"rootUri":      (&url.URL{Scheme: "file", Path: s.Root}).String(),
+			"capabilities": map[string]interface{}{},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "Could not encode the initialize request")
+	}
+
+	_, err = fmt.Fprintf(conn, "Content-Length: %d\r\n\r\n%s", len(req), req)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Could not send the initialize request to the %s server", s.name))
+	}
+
+	body, err := readMessage(bufio.NewReader(conn))
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Could not read the initialize response from the %s server", s.name))
+	}
+
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("The %s server sent an invalid initialize response", s.name))
+	}
+	if resp.Error != nil {
+		return errors.Errorf("The %s server returned an error for the initialize request: %s", s.name, resp.Error.Message)
+	}
+	if len(resp.Result) == 0 {
+		return errors.Errorf("The %s server's initialize response did not contain a result", s.name)
+	}
+
+	return nil
+}
+
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 && strings.EqualFold(strings.TrimSpace(parts[0]), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return nil, errors.Wrap(err, "Invalid Content-Length header")
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, errors.New("The response did not have a Content-Length header")
+	}
+
+	body := make([]byte, length)
+	_, err := io.ReadFull(r, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
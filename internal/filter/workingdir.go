@@ -0,0 +1,113 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type WorkingDirKind int
+
+const (
+	// WorkingDirRoot runs the command from the checkout root. This is the
+	// default.
+	WorkingDirRoot WorkingDirKind = iota
+	// WorkingDirConfig runs the command from the directory containing the
+	// config file.
+	WorkingDirConfig
+	// WorkingDirFile runs the command from the directory containing each
+	// file.
+	WorkingDirFile
+	// WorkingDirNearest runs the command from the closest directory at or
+	// above each file which contains the marker file.
+	WorkingDirNearest
+)
+
+type WorkingDir struct {
+	Kind   WorkingDirKind
+	Marker string
+}
+
+const nearestPrefix = "nearest:"
+
+// ParseWorkingDir parses the value of a filter's working_dir key, which is
+// one of "root", "config", "file", or "nearest:<marker file>". An empty string
+// is treated as "root".
+func ParseWorkingDir(s string) (WorkingDir, error) {
+	switch s {
+	case "", "root":
+		return WorkingDir{Kind: WorkingDirRoot}, nil
+	case "config":
+		return WorkingDir{Kind: WorkingDirConfig}, nil
+	case "file":
+		return WorkingDir{Kind: WorkingDirFile}, nil
+	}
+
+	if strings.HasPrefix(s, nearestPrefix) {
+		marker := strings.TrimPrefix(s, nearestPrefix)
+		if marker == "" || strings.ContainsRune(marker, filepath.Separator) {
+			return WorkingDir{}, errors.Errorf("The marker file in %q must be a plain file name", s)
+		}
+		return WorkingDir{Kind: WorkingDirNearest, Marker: marker}, nil
+	}
+
+	return WorkingDir{}, errors.Errorf(`The working dir %q must be one of "root", "config", "file", or "nearest:<marker file>"`, s)
+}
+
+// IsPerFile returns true if the directory depends on the file being filtered.
+func (wd WorkingDir) IsPerFile() bool {
+	return wd.Kind == WorkingDirFile || wd.Kind == WorkingDirNearest
+}
+
+// Resolve returns the directory a command should be run from for the given
+// path.
+func (wd WorkingDir) Resolve(root, configDir, path string) (string, error) {
+	switch wd.Kind {
+	case WorkingDirConfig:
+		return configDir, nil
+	case WorkingDirFile:
+		return fileDir(path)
+	case WorkingDirNearest:
+		return nearest(root, wd.Marker, path)
+	default:
+		return root, nil
+	}
+}
+
+func fileDir(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", errors.Wrap(err, "Could not get abs path for "+path)
+	}
+
+	fi, err := os.Stat(abs)
+	if err == nil && fi.IsDir() {
+		return abs, nil
+	}
+
+	return filepath.Dir(abs), nil
+}
+
+func nearest(root, marker, path string) (string, error) {
+	dir, err := fileDir(path)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		_, err := os.Stat(filepath.Join(dir, marker))
+		if err == nil {
+			return dir, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if dir == root || parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	return "", errors.Errorf("Could not find %s in any directory at or above %s", marker, path)
+}
@@ -0,0 +1,295 @@
+package gitattributes
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/houseabsolute/precious/internal/gitignore"
+	"github.com/houseabsolute/precious/internal/gitrepo"
+	"github.com/pkg/errors"
+)
+
+// These are the precedence levels for the different sources of attributes,
+// from lowest to highest, as described at
+// https://git-scm.com/docs/gitattributes. Attributes from .gitattributes
+// files have a precedence of perDirPrecedence plus their depth, so a file in
+// a subdirectory overrides its parents. The repo's info/attributes file
+// overrides everything.
+const (
+	attributesFilePrecedence = iota
+	perDirPrecedence
+	infoAttributesPrecedence = 1 << 16
+)
+
+// An attr is a single attribute assignment from a line. Git distinguishes
+// between an attribute that is set ("foo"), unset ("-foo"), set to a value
+// ("foo=bar"), and unspecified ("!foo"). We represent set and unset as the
+// values "true" and "false".
+type attr struct {
+	name        string
+	value       string
+	unspecified bool
+}
+
+type line struct {
+	pattern *gitignore.Pattern
+	attrs   []attr
+}
+
+type source struct {
+	file       string
+	base       string
+	precedence int
+	lines      []line
+}
+
+// The binary macro is built in to git.
+var builtinMacros = map[string][]attr{
+	"binary": {
+		{name: "diff", value: "false"},
+		{name: "merge", value: "false"},
+		{name: "text", value: "false"},
+	},
+}
+
+// Matcher finds the attributes for paths using the same rules as git. It
+// combines the user's core.attributesFile, the repo's info/attributes, and
+// the .gitattributes file in each directory.
+type Matcher struct {
+	root    string
+	sources []*source
+	macros  map[string][]attr
+	loaded  map[string]bool
+}
+
+// New returns a Matcher for paths under root.
+func New(root string) (*Matcher, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not get abs path for %s", root))
+	}
+
+	macros := map[string][]attr{}
+	for k, v := range builtinMacros {
+		macros[k] = v
+	}
+
+	return &Matcher{
+		root:   abs,
+		macros: macros,
+		loaded: map[string]bool{},
+	}, nil
+}
+
+// LoadDir adds the .gitattributes file in the given directory, if there is
+// one.
+func (m *Matcher) LoadDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Could not get abs path for %s", dir))
+	}
+
+	return m.addIfExists(filepath.Join(abs, ".gitattributes"), abs, perDirPrecedence+gitrepo.Depth(m.root, abs))
+}
+
+// LoadParents adds the .gitattributes files in each directory from the root
+// down to the given path's directory.
+func (m *Matcher) LoadParents(path string) error {
+	dirs, err := gitrepo.ParentDirs(m.root, path)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		err = m.LoadDir(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddGitAttributes adds the attributes from the user's core.attributesFile
+// and the repo's info/attributes file, if the root is a git checkout.
+func (m *Matcher) AddGitAttributes() error {
+	if !gitrepo.IsRoot(m.root) {
+		return nil
+	}
+
+	attributesFile, err := gitrepo.UserFile(m.root, "core.attributesFile", "attributes")
+	if err != nil {
+		return err
+	}
+	if attributesFile != "" {
+		err = m.addIfExists(attributesFile, m.root, attributesFilePrecedence)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.addIfExists(gitrepo.GitPath(m.root, "info/attributes"), m.root, infoAttributesPrecedence)
+}
+
+// Attributes returns the attributes that are set for the file at path. An
+// attribute that is set has the value "true" and one that is unset has the
+// value "false". Unspecified attributes are not included.
+func (m *Matcher) Attributes(path string) map[string]string {
+	attrs := map[string]string{}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return attrs
+	}
+
+	for _, s := range m.sources {
+		rel, ok := gitrepo.Relative(s.base, abs)
+		if !ok || rel == "" {
+			continue
+		}
+		for _, l := range s.lines {
+			if !l.pattern.Matches(rel, false) {
+				continue
+			}
+			for _, a := range l.attrs {
+				m.apply(attrs, a)
+			}
+		}
+	}
+
+	return attrs
+}
+
+func (m *Matcher) apply(attrs map[string]string, a attr) {
+	if a.unspecified {
+		delete(attrs, a.name)
+		return
+	}
+
+	attrs[a.name] = a.value
+	if a.value != "true" {
+		return
+	}
+	for _, ma := range m.macros[a.name] {
+		m.apply(attrs, ma)
+	}
+}
+
+func (m *Matcher) addIfExists(file, base string, precedence int) error {
+	if m.loaded[file] {
+		return nil
+	}
+
+	_, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Could not stat %s", file))
+	}
+
+	lines, err := m.parseFile(file)
+	if err != nil {
+		return err
+	}
+
+	m.loaded[file] = true
+	m.sources = append(m.sources, &source{file, base, precedence, lines})
+	sort.SliceStable(m.sources, func(i, j int) bool {
+		return m.sources[i].precedence < m.sources[j].precedence
+	})
+
+	return nil
+}
+
+// Macros can be defined in any file, but git only honors them in the
+// top-level .gitattributes file and the global files. We accept them
+// anywhere, since a macro defined in a subdirectory is almost certainly
+// meant to be used.
+func (m *Matcher) parseFile(file string) ([]line, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not read attributes file %s", file))
+	}
+	defer f.Close()
+
+	lines := []line{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		text := strings.TrimSpace(strings.TrimSuffix(s.Text(), "\r"))
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		pat, rest := splitPattern(text)
+		attrs := parseAttrs(rest)
+
+		if strings.HasPrefix(pat, "[attr]") {
+			m.macros[strings.TrimPrefix(pat, "[attr]")] = attrs
+			continue
+		}
+		// Negative patterns are forbidden in attributes files, and git
+		// ignores them with a warning.
+		if strings.HasPrefix(pat, "!") {
+			continue
+		}
+
+		p := gitignore.ParsePattern(pat)
+		if p == nil {
+			continue
+		}
+		lines = append(lines, line{p, attrs})
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not read attributes file %s", file))
+	}
+
+	return lines, nil
+}
+
+// A pattern can be quoted like a C string so that it can contain spaces.
+func splitPattern(text string) (string, string) {
+	if strings.HasPrefix(text, `"`) {
+		for i := 1; i < len(text); i++ {
+			if text[i] == '\\' {
+				i++
+				continue
+			}
+			if text[i] == '"' {
+				if pat, err := strconv.Unquote(text[:i+1]); err == nil {
+					return pat, text[i+1:]
+				}
+				break
+			}
+		}
+	}
+
+	i := strings.IndexAny(text, " \t")
+	if i == -1 {
+		return text, ""
+	}
+	return text[:i], text[i+1:]
+}
+
+func parseAttrs(s string) []attr {
+	attrs := []attr{}
+	for _, f := range strings.Fields(s) {
+		switch {
+		case strings.HasPrefix(f, "-"):
+			attrs = append(attrs, attr{name: f[1:], value: "false"})
+		case strings.HasPrefix(f, "!"):
+			attrs = append(attrs, attr{name: f[1:], unspecified: true})
+		case strings.Contains(f, "="):
+			kv := strings.SplitN(f, "=", 2)
+			attrs = append(attrs, attr{name: kv[0], value: kv[1]})
+		default:
+			attrs = append(attrs, attr{name: f, value: "true"})
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,255 @@
+package gitignore
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/houseabsolute/precious/internal/gitrepo"
+	"github.com/pkg/errors"
+)
+
+// These are the precedence levels for the different sources of patterns,
+// from lowest to highest. Patterns from .gitignore files have a precedence
+// of perDirPrecedence plus their depth, so a file in a subdirectory
+// overrides its parents.
+const (
+	excludesFilePrecedence = iota
+	infoExcludePrecedence
+	perDirPrecedence
+)
+
+type source struct {
+	file       string
+	base       string
+	precedence int
+	patterns   []*pattern
+	// This is true for the .gitignore files and git excludes, which git
+	// itself uses, as opposed to files added with AddFile.
+	git bool
+}
+
+// Matcher decides whether paths are ignored using the same rules as git. It
+// combines the user's core.excludesFile, the repo's .git/info/exclude, and
+// any number of gitignore-style files, each of which applies to the
+// directory it is in and everything below it.
+//
+// The Matcher does not look at the index itself. Like git, it does not apply
+// the patterns from .gitignore files and the git excludes to paths passed to
+// SetTracked, but the patterns from files added with AddFile apply to every
+// path. Without SetTracked, a tracked file that matches a pattern is
+// ignored, which is what we want when we are not asking git for the paths.
+type Matcher struct {
+	root    string
+	sources []*source
+	loaded  map[string]bool
+	tracked map[string]bool
+}
+
+// New returns a Matcher for paths under root. The root is used to determine
+// the precedence of ignore files, and is where the git excludes are found.
+func New(root string) (*Matcher, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not get abs path for %s", root))
+	}
+
+	return &Matcher{
+		root:    abs,
+		loaded:  map[string]bool{},
+		tracked: map[string]bool{},
+	}, nil
+}
+
+// CompileFile parses a gitignore-style file and returns an error if it cannot
+// be read.
+func CompileFile(file string) error {
+	_, err := parseFile(file)
+	return err
+}
+
+// AddFile adds the patterns in a gitignore-style file. The patterns are
+// matched relative to the file's directory, just like a .gitignore file.
+// Adding the same file more than once has no effect.
+func (m *Matcher) AddFile(file string) error {
+	return m.addPerDir(file, false)
+}
+
+// SetTracked tells the Matcher that the given paths are tracked by git, so
+// git's own ignore patterns don't apply to them.
+func (m *Matcher) SetTracked(paths []string) {
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		m.tracked[abs] = true
+	}
+}
+
+func (m *Matcher) addPerDir(file string, git bool) error {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Could not get abs path for %s", file))
+	}
+
+	base := filepath.Dir(abs)
+	return m.add(abs, base, perDirPrecedence+gitrepo.Depth(m.root, base), git)
+}
+
+// LoadDir adds the .gitignore file in the given directory, if there is one.
+func (m *Matcher) LoadDir(dir string) error {
+	file := filepath.Join(dir, ".gitignore")
+	_, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Could not stat %s", file))
+	}
+
+	return m.addPerDir(file, true)
+}
+
+// LoadParents adds the .gitignore files in each directory from the root down
+// to the given path's directory. This is needed before checking a path that
+// was not found by walking the tree from the root.
+func (m *Matcher) LoadParents(path string) error {
+	dirs, err := gitrepo.ParentDirs(m.root, path)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		err = m.LoadDir(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddGitExcludes adds the patterns from the user's core.excludesFile and the
+// repo's info/exclude file, if the root is a git checkout.
+func (m *Matcher) AddGitExcludes() error {
+	if !gitrepo.IsRoot(m.root) {
+		return nil
+	}
+
+	excludesFile, err := gitrepo.UserFile(m.root, "core.excludesFile", "ignore")
+	if err != nil {
+		return err
+	}
+	if excludesFile != "" {
+		err = m.addIfExists(excludesFile, excludesFilePrecedence)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.addIfExists(gitrepo.GitPath(m.root, "info/exclude"), infoExcludePrecedence)
+}
+
+// Ignored returns true if the path is ignored. Like git, a path inside an
+// ignored directory is always ignored, even if a later pattern would
+// re-include it, unless the path is tracked.
+func (m *Matcher) Ignored(path string, isDir bool) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	tracked := m.tracked[abs]
+
+	rel, ok := gitrepo.Relative(m.root, abs)
+	if ok && rel != "" {
+		parts := strings.Split(rel, "/")
+		dir := m.root
+		for _, p := range parts[:len(parts)-1] {
+			dir = filepath.Join(dir, p)
+			if m.matches(dir, true, tracked) {
+				return true
+			}
+		}
+	}
+
+	return m.matches(abs, isDir, tracked)
+}
+
+// Within each source the last matching pattern wins, and sources with a
+// higher precedence override lower ones, so we can simply check every
+// pattern in order and keep the last match.
+func (m *Matcher) matches(abs string, isDir, tracked bool) bool {
+	ignored := false
+	for _, s := range m.sources {
+		if tracked && s.git {
+			continue
+		}
+		rel, ok := gitrepo.Relative(s.base, abs)
+		if !ok || rel == "" {
+			continue
+		}
+		for _, p := range s.patterns {
+			if p.matches(rel, isDir) {
+				ignored = !p.negate
+			}
+		}
+	}
+	return ignored
+}
+
+func (m *Matcher) add(file, base string, precedence int, git bool) error {
+	if m.loaded[file] {
+		return nil
+	}
+
+	patterns, err := parseFile(file)
+	if err != nil {
+		return err
+	}
+
+	m.loaded[file] = true
+	m.sources = append(m.sources, &source{file, base, precedence, patterns, git})
+	sort.SliceStable(m.sources, func(i, j int) bool {
+		return m.sources[i].precedence < m.sources[j].precedence
+	})
+
+	return nil
+}
+
+// The excludes files apply to the whole checkout, so their base is the root.
+func (m *Matcher) addIfExists(file string, precedence int) error {
+	_, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Could not stat %s", file))
+	}
+
+	return m.add(file, m.root, precedence, true)
+}
+
+func parseFile(file string) ([]*pattern, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not read ignore file %s", file))
+	}
+	defer f.Close()
+
+	patterns := []*pattern{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if p := parseLine(s.Text()); p != nil {
+			patterns = append(patterns, p)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not read ignore file %s", file))
+	}
+
+	return patterns, nil
+}
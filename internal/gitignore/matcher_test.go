@@ -0,0 +1,357 @@
+package gitignore
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type check struct {
+	path    string
+	ignored bool
+}
+
+// Each case is a fixture repo. The files are written before the checks are
+// run, and every checked path is created as well. A checked path that ends
+// with a slash is a directory. The expected results were generated with
+// "git check-ignore --no-index", and the test checks that git still agrees
+// with them when git is available.
+var conformanceTests = []struct {
+	name     string
+	files    map[string]string
+	excludes string
+	checks   []check
+}{
+	{
+		name: "negation",
+		files: map[string]string{
+			".gitignore": "*.log\n!keep.log\nbuild/\n!build/keep.txt\n",
+		},
+		checks: []check{
+			{"a.log", true},
+			{"keep.log", false},
+			{"sub/a.log", true},
+			{"sub/keep.log", false},
+			{"build/", true},
+			// A file in an ignored directory can't be re-included.
+			{"build/keep.txt", true},
+			{"a.txt", false},
+		},
+	},
+	{
+		name: "negation order",
+		files: map[string]string{
+			".gitignore": "!a.txt\n*.txt\n",
+		},
+		checks: []check{
+			{"a.txt", true},
+			{"b.txt", true},
+		},
+	},
+	{
+		name: "double star",
+		files: map[string]string{
+			".gitignore": "**/foo\na/**/b\nlogs/**\n",
+		},
+		checks: []check{
+			{"foo", true},
+			{"x/foo", true},
+			{"x/y/foo", true},
+			{"a/b", true},
+			{"a/x/b", true},
+			{"a/x/y/b", true},
+			{"x/a/b", false},
+			{"logs/", false},
+			{"logs/x.log", true},
+			{"logs/x/y.log", true},
+			{"x/logs/y.log", false},
+		},
+	},
+	{
+		name: "anchored and unanchored",
+		files: map[string]string{
+			".gitignore": "/top.txt\nany.txt\ndoc/frotz\n",
+		},
+		checks: []check{
+			{"top.txt", true},
+			{"sub/top.txt", false},
+			{"any.txt", true},
+			{"sub/any.txt", true},
+			{"sub/deeper/any.txt", true},
+			{"doc/frotz", true},
+			{"a/doc/frotz", false},
+		},
+	},
+	{
+		name: "directory only",
+		files: map[string]string{
+			".gitignore": "tmp/\n/out/\n",
+		},
+		checks: []check{
+			{"tmp/", true},
+			{"tmp/file", true},
+			{"sub/tmp/", true},
+			{"sub/tmp/file", true},
+			{"other/tmp", false},
+			{"out/", true},
+			{"out/file", true},
+			{"sub/out/", false},
+			{"sub/out/file", false},
+		},
+	},
+	{
+		name: "wildcards and escapes",
+		files: map[string]string{
+			".gitignore": "file?.c\n[abc].h\n[!x]y.go\n\\#hash\n\\!bang\ntrailing\\ \n",
+		},
+		checks: []check{
+			{"file1.c", true},
+			{"file10.c", false},
+			{"a.h", true},
+			{"d.h", false},
+			{"ay.go", true},
+			{"xy.go", false},
+			{"#hash", true},
+			{"!bang", true},
+			{"trailing ", true},
+			{"trailing", false},
+		},
+	},
+	{
+		name: "nested gitignore files",
+		files: map[string]string{
+			".gitignore":          "*.txt\n/anchored\n",
+			"sub/.gitignore":      "!keep.txt\n/anchored\n",
+			"sub/deep/.gitignore": "*.md\n",
+		},
+		checks: []check{
+			{"a.txt", true},
+			{"keep.txt", true},
+			{"sub/a.txt", true},
+			{"sub/keep.txt", false},
+			{"sub/deep/keep.txt", false},
+			{"anchored", true},
+			{"sub/anchored", true},
+			{"sub/x/anchored", false},
+			{"sub/deep/a.md", true},
+			{"sub/a.md", false},
+			{"a.md", false},
+		},
+	},
+	{
+		name: "git excludes",
+		files: map[string]string{
+			".git/info/exclude": "*.tmp\n!keep.bak\n",
+			".gitignore":        "!keep.tmp\n",
+		},
+		excludes: "*.bak\n*.swp\n",
+		checks: []check{
+			{"a.swp", true},
+			{"sub/a.swp", true},
+			{"a.bak", true},
+			// The info/exclude file overrides core.excludesFile.
+			{"keep.bak", false},
+			{"a.tmp", true},
+			// A .gitignore file overrides both.
+			{"keep.tmp", false},
+			{"a.txt", false},
+		},
+	},
+}
+
+func TestConformance(t *testing.T) {
+	git, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("These tests require git")
+	}
+
+	// Keep the user's own git config and global ignore file out of this.
+	home := tempDir(t)
+	defer os.RemoveAll(home)
+	setenv(t, "HOME", home)
+	setenv(t, "XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	setenv(t, "GIT_CONFIG_NOSYSTEM", "1")
+
+	for _, test := range conformanceTests {
+		t.Run(test.name, func(t *testing.T) {
+			root := tempDir(t)
+			defer os.RemoveAll(root)
+
+			runGit(t, git, root, "init", "-q")
+			if test.excludes != "" {
+				file := filepath.Join(home, test.name+".excludes")
+				writeFile(t, file, test.excludes)
+				runGit(t, git, root, "config", "core.excludesFile", file)
+			}
+			for name, content := range test.files {
+				writeFile(t, filepath.Join(root, name), content)
+			}
+
+			m, err := New(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = m.AddGitExcludes()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, c := range test.checks {
+				isDir := strings.HasSuffix(c.path, "/")
+				abs := filepath.Join(root, filepath.FromSlash(c.path))
+				if isDir {
+					err = os.MkdirAll(abs, 0755)
+				} else {
+					writeFile(t, abs, "")
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				err = m.LoadParents(abs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := m.Ignored(abs, isDir); got != c.ignored {
+					t.Errorf("Ignored(%q) = %t, want %t", c.path, got, c.ignored)
+				}
+
+				if got := gitIgnores(t, git, root, strings.TrimSuffix(c.path, "/")); got != c.ignored {
+					t.Errorf("git check-ignore says %q ignored = %t, but the test expects %t", c.path, got, c.ignored)
+				}
+			}
+		})
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "precious-gitignore-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The temp dir may be behind a symlink, as it is on macOS.
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func setenv(t *testing.T, name, val string) {
+	old, ok := os.LookupEnv(name)
+	err := os.Setenv(name, val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func writeFile(t *testing.T, file, content string) {
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(file, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func runGit(t *testing.T, git, dir string, args ...string) {
+	cmd := exec.Command(git, args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %s\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+// This exits with 0 if the path is ignored and 1 if it is not. Git looks at
+// the path on disk to see whether it's a directory. Passing a directory with
+// a trailing slash makes git match the slash literally, so a pattern like
+// "logs/**" would match "logs/".
+func gitIgnores(t *testing.T, git, root, path string) bool {
+	cmd := exec.Command(git, "check-ignore", "-q", "--no-index", path)
+	cmd.Dir = root
+	err := cmd.Run()
+	if err == nil {
+		return true
+	}
+	if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() == 1 {
+		return false
+	}
+	t.Fatalf("git check-ignore %s failed: %s", path, err)
+	return false
+}
+
+// Git never treats a tracked file as ignored, and neither do we once we're
+// told which files are tracked. Patterns from files added with AddFile still
+// apply to them.
+func TestTrackedFilesAreNotIgnored(t *testing.T) {
+	git, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("These tests require git")
+	}
+
+	root := tempDir(t)
+	defer os.RemoveAll(root)
+
+	runGit(t, git, root, "init", "-q")
+	writeFile(t, filepath.Join(root, ".gitignore"), "vendor/\n*.gen\n")
+	writeFile(t, filepath.Join(root, "precious-ignore"), "*.gen\n")
+	for _, f := range []string{"vendor/lib.go", "vendor/other.go", "a.gen"} {
+		writeFile(t, filepath.Join(root, filepath.FromSlash(f)), "")
+	}
+	runGit(t, git, root, "add", "-f", "vendor/lib.go", "a.gen")
+
+	m, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetTracked([]string{
+		filepath.Join(root, "vendor", "lib.go"),
+		filepath.Join(root, "a.gen"),
+	})
+
+	checks := []check{
+		{"vendor/lib.go", false},
+		{"vendor/other.go", true},
+	}
+	for _, c := range checks {
+		file := filepath.Join(root, filepath.FromSlash(c.path))
+		err = m.LoadParents(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Ignored(file, false); got != c.ignored {
+			t.Errorf("Ignored(%q) = %t, want %t", c.path, got, c.ignored)
+		}
+
+		cmd := exec.Command(git, "check-ignore", "-q", c.path)
+		cmd.Dir = root
+		if got := cmd.Run() == nil; got != c.ignored {
+			t.Errorf("git check-ignore says %q ignored = %t, but the test expects %t", c.path, got, c.ignored)
+		}
+	}
+
+	gen := filepath.Join(root, "a.gen")
+	if m.Ignored(gen, false) {
+		t.Errorf("Ignored(%q) = true before adding our own ignore file, want false", "a.gen")
+	}
+	err = m.AddFile(filepath.Join(root, "precious-ignore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Ignored(gen, false) {
+		t.Errorf("Ignored(%q) = false with our own ignore file, want true", "a.gen")
+	}
+}
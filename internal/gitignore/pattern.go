@@ -0,0 +1,251 @@
+package gitignore
+
+import (
+	"strings"
+)
+
+// A pattern is a single line from a gitignore file, parsed according to the
+// rules at https://git-scm.com/docs/gitignore.
+type pattern struct {
+	// The pattern split on "/", with any leading slash removed. A "**"
+	// segment matches zero or more directories.
+	segments []string
+	// A negated pattern ("!foo") re-includes paths that an earlier pattern
+	// ignored.
+	negate bool
+	// A pattern with a trailing slash ("foo/") only matches directories.
+	dirOnly bool
+	// A pattern with a slash anywhere but at the end is matched against the
+	// path relative to the ignore file's directory. Other patterns are
+	// matched against the path's basename at any depth.
+	anchored bool
+}
+
+// parseLine returns nil for blank lines and comments.
+func parseLine(line string) *pattern {
+	line = strings.TrimSuffix(line, "\r")
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	line = trimTrailingSpaces(line)
+	if line == "" {
+		return nil
+	}
+
+	p := &pattern{}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil
+	}
+
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return nil
+	}
+
+	p.segments = strings.Split(line, "/")
+
+	return p
+}
+
+// Trailing spaces are ignored unless they are escaped with a backslash.
+func trimTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") {
+		trimmed := strings.TrimSuffix(line, " ")
+		if escaped(trimmed) {
+			return line
+		}
+		line = trimmed
+	}
+	return line
+}
+
+// Returns true if the string ends with an odd number of backslashes, in
+// which case the character after it is escaped.
+func escaped(s string) bool {
+	n := 0
+	for i := len(s) - 1; i >= 0 && s[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// matches checks the pattern against a slash-separated path relative to the
+// directory of the file the pattern came from.
+func (p *pattern) matches(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	if !p.anchored {
+		return matchSegment(p.segments[0], rel[strings.LastIndex(rel, "/")+1:])
+	}
+
+	return matchSegments(p.segments, strings.Split(rel, "/"))
+}
+
+func matchSegments(pat, path []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			// A trailing "/**" matches everything inside a directory, but
+			// not the directory itself.
+			if len(pat) == 1 {
+				return len(path) > 0
+			}
+			for i := 0; i <= len(path); i++ {
+				if matchSegments(pat[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(path) == 0 || !matchSegment(pat[0], path[0]) {
+			return false
+		}
+		pat = pat[1:]
+		path = path[1:]
+	}
+
+	return len(path) == 0
+}
+
+// matchSegment implements fnmatch for a single path segment, supporting "*",
+// "?", "[...]" classes, and backslash escapes. Any other "**" in a segment is
+// treated like "*".
+func matchSegment(pat, s string) bool {
+	for len(pat) > 0 {
+		switch pat[0] {
+		case '*':
+			pat = strings.TrimLeft(pat, "*")
+			if pat == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchSegment(pat, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+			pat = pat[1:]
+			s = s[1:]
+		case '[':
+			if s == "" {
+				return false
+			}
+			matched, rest, ok := matchClass(pat, s[0])
+			if !ok {
+				// An unterminated class is matched literally.
+				if s[0] != '[' {
+					return false
+				}
+				pat = pat[1:]
+				s = s[1:]
+				continue
+			}
+			if !matched {
+				return false
+			}
+			pat = rest
+			s = s[1:]
+		case '\\':
+			if len(pat) > 1 {
+				pat = pat[1:]
+			}
+			fallthrough
+		default:
+			if s == "" || s[0] != pat[0] {
+				return false
+			}
+			pat = pat[1:]
+			s = s[1:]
+		}
+	}
+
+	return s == ""
+}
+
+// matchClass matches a character against a bracket expression at the start
+// of pat. It returns whether the character matched, the rest of the pattern
+// after the expression, and whether the expression was valid.
+func matchClass(pat string, c byte) (bool, string, bool) {
+	i := 1
+	negate := false
+	if i < len(pat) && (pat[i] == '!' || pat[i] == '^') {
+		negate = true
+		i++
+	}
+
+	matched := false
+	first := true
+	for i < len(pat) {
+		if pat[i] == ']' && !first {
+			return matched != negate, pat[i+1:], true
+		}
+		first = false
+
+		lo := pat[i]
+		if lo == '\\' && i+1 < len(pat) {
+			i++
+			lo = pat[i]
+		}
+		i++
+
+		hi := lo
+		if i+1 < len(pat) && pat[i] == '-' && pat[i+1] != ']' {
+			hi = pat[i+1]
+			if hi == '\\' && i+2 < len(pat) {
+				i++
+				hi = pat[i+1]
+			}
+			i += 2
+		}
+
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+
+	return false, "", false
+}
+
+// Pattern is a single gitignore pattern. The paths in a .gitattributes file
+// use the same syntax, except that they cannot be negated.
+type Pattern struct {
+	p *pattern
+}
+
+// ParsePattern parses a single pattern. It returns nil if the pattern is
+// blank or a comment.
+func ParsePattern(s string) *Pattern {
+	p := parseLine(s)
+	if p == nil {
+		return nil
+	}
+	return &Pattern{p}
+}
+
+// Matches checks the pattern against a slash-separated path relative to the
+// directory of the file the pattern came from.
+func (p *Pattern) Matches(rel string, isDir bool) bool {
+	return p.p.matches(rel, isDir)
+}
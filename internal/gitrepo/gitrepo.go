@@ -0,0 +1,71 @@
+package gitrepo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const gitdirPrefix = "gitdir: "
+
+// IsRoot returns true if the directory is the top of a git checkout. The
+// .git entry is a directory in a normal checkout. In a linked worktree or a
+// submodule it is a file that points to the real git directory.
+func IsRoot(dir string) bool {
+	fi, err := os.Stat(filepath.Join(dir, ".git"))
+	if err != nil {
+		return false
+	}
+	if fi.IsDir() {
+		return true
+	}
+	return gitDirFromFile(dir) != ""
+}
+
+// IsSubmodule returns true if the directory is the top of a submodule's
+// checkout. We ask git for the submodule's superproject rather than looking
+// at where the .git file points, since that depends on how the submodule
+// was cloned.
+func IsSubmodule(dir string) bool {
+	if !IsRoot(dir) {
+		return false
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return false
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command("git", "rev-parse", "--show-superproject-working-tree")
+	cmd.Dir = dir
+	cmd.Stdout = &out
+	if cmd.Run() != nil {
+		return false
+	}
+
+	return strings.TrimSpace(out.String()) != ""
+}
+
+// The path in a .git file may be relative to the directory containing it.
+func gitDirFromFile(dir string) string {
+	content, err := ioutil.ReadFile(filepath.Join(dir, ".git"))
+	if err != nil {
+		return ""
+	}
+
+	line := strings.TrimSpace(strings.SplitN(string(content), "\n", 2)[0])
+	if !strings.HasPrefix(line, gitdirPrefix) {
+		return ""
+	}
+
+	gitDir := strings.TrimSpace(strings.TrimPrefix(line, gitdirPrefix))
+	if gitDir == "" {
+		return ""
+	}
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(dir, gitDir)
+	}
+	return filepath.Clean(gitDir)
+}
@@ -0,0 +1,130 @@
+package gitrepo
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+// GitPath returns the path to a file in the git dir for the checkout at
+// root, like "info/exclude". In a worktree or a checkout with a separate git
+// dir, .git is a file and the git dir is somewhere else, so we ask git where
+// to look. If we can't run git we assume the git dir is root/.git.
+func GitPath(root, name string) string {
+	fallback := filepath.Join(root, ".git", filepath.FromSlash(name))
+	if _, err := exec.LookPath("git"); err != nil {
+		return fallback
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command("git", "rev-parse", "--git-path", name)
+	cmd.Dir = root
+	cmd.Stdout = &out
+	if cmd.Run() != nil {
+		return fallback
+	}
+
+	p := strings.TrimSpace(out.String())
+	if p == "" {
+		return fallback
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(root, p)
+	}
+
+	return p
+}
+
+// UserFile returns the path of a per-user file that git reads, like the
+// global ignore file. If the config key is not set git uses
+// $XDG_CONFIG_HOME/git/name, or ~/.config/git/name if $XDG_CONFIG_HOME is
+// not set.
+func UserFile(root, key, name string) (string, error) {
+	if _, err := exec.LookPath("git"); err == nil {
+		var out bytes.Buffer
+		cmd := exec.Command("git", "config", "--path", key)
+		cmd.Dir = root
+		cmd.Stdout = &out
+		// This exits with 1 when the key is not set.
+		if cmd.Run() == nil {
+			if f := strings.TrimSpace(out.String()); f != "" {
+				return f, nil
+			}
+		}
+	}
+
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", name), nil
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", errors.Wrap(err, "Could not find your home directory")
+	}
+
+	return filepath.Join(home, ".config", "git", name), nil
+}
+
+// Relative returns the path of abs relative to base, or false if it is not
+// under base. The relative path always uses "/" as the separator, since
+// that's what ignore and attributes patterns use. It is empty if abs is
+// base.
+func Relative(base, abs string) (string, bool) {
+	rel, err := filepath.Rel(base, abs)
+	if err != nil {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		return "", true
+	}
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return rel, true
+}
+
+// Depth returns how many directories deep dir is below root. Per-directory
+// files like .gitignore that are deeper override the ones above them.
+func Depth(root, dir string) int {
+	rel, ok := Relative(root, dir)
+	if !ok || rel == "" {
+		return 0
+	}
+	return strings.Count(rel, "/") + 1
+}
+
+// ParentDirs returns root and each directory below it down to the given
+// path's directory, in that order. These are the directories whose
+// per-directory files apply to the path. If the path is not under root this
+// returns nothing.
+func ParentDirs(root, path string) ([]string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not get abs path for %s", path))
+	}
+
+	rel, ok := Relative(root, filepath.Dir(abs))
+	if !ok {
+		return nil, nil
+	}
+
+	dirs := []string{root}
+	if rel == "" {
+		return dirs, nil
+	}
+
+	dir := root
+	for _, d := range strings.Split(rel, "/") {
+		dir = filepath.Join(dir, d)
+		dirs = append(dirs, dir)
+	}
+
+	return dirs, nil
+}
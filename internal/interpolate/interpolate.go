@@ -0,0 +1,203 @@
+package interpolate
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Vars holds the values for the variables that can be used anywhere in a
+// config value. These are expanded once, when the config is loaded.
+type Vars struct {
+	ConfigDir string
+	Root      string
+	Cwd       string
+}
+
+// This matches either "${...}" or a bare "$NAME". Names are only replaced if
+// they are one of our known variables or start with "env:", so that things
+// like "$@", "$HOME", or "${HOME}" in a shell snippet pass through untouched.
+var varRE = regexp.MustCompile(`\$\{([^}]*)\}|\$([A-Z][A-Z0-9_]*)`)
+
+func (v Vars) lookup(name string) (string, bool) {
+	switch name {
+	case "CONFIG_DIR":
+		return v.ConfigDir, true
+	case "ROOT":
+		return v.Root, true
+	case "CWD":
+		return v.Cwd, true
+	}
+	return "", false
+}
+
+// Expand replaces $CONFIG_DIR, $ROOT, $CWD, and ${env:NAME} in the given
+// string. Environment variables may have a default, as in
+// ${env:NAME:-default}. An environment variable without a default that is
+// not set is an error. Any other variable is left as is, so it can be
+// expanded by a shell later.
+func (v Vars) Expand(s string) (string, error) {
+	var errs []string
+	expanded := varRE.ReplaceAllStringFunc(s, func(m string) string {
+		sub := varRE.FindStringSubmatch(m)
+		if sub[2] != "" {
+			if val, ok := v.lookup(sub[2]); ok {
+				return val
+			}
+			return m
+		}
+
+		val, ok, err := v.expandBraced(sub[1])
+		if err != nil {
+			errs = append(errs, err.Error())
+			return m
+		}
+		if !ok {
+			return m
+		}
+		return val
+	})
+
+	if len(errs) != 0 {
+		return "", errors.New(strings.Join(errs, "; "))
+	}
+
+	return expanded, nil
+}
+
+// ExpandAll calls Expand on each of the given strings.
+func (v Vars) ExpandAll(vals []string) ([]string, error) {
+	expanded := []string{}
+	for _, s := range vals {
+		e, err := v.Expand(s)
+		if err != nil {
+			return []string{}, err
+		}
+		expanded = append(expanded, e)
+	}
+	return expanded, nil
+}
+
+// This returns false if the name is not one of ours.
+func (v Vars) expandBraced(inner string) (string, bool, error) {
+	if !strings.HasPrefix(inner, "env:") {
+		val, ok := v.lookup(inner)
+		return val, ok, nil
+	}
+
+	name := strings.TrimPrefix(inner, "env:")
+	def := ""
+	hasDef := false
+	if i := strings.Index(name, ":-"); i != -1 {
+		def = name[i+2:]
+		name = name[:i]
+		hasDef = true
+	}
+
+	if name == "" {
+		return "", false, errors.Errorf("The variable ${%s} does not include an environment variable name", inner)
+	}
+
+	if val, ok := os.LookupEnv(name); ok {
+		return val, true, nil
+	}
+	if hasDef {
+		return def, true, nil
+	}
+
+	return "", false, errors.Errorf("The environment variable %s is not set and ${%s} does not provide a default", name, inner)
+}
+
+const (
+	pathPlaceholder    = "{path}"
+	dirPlaceholder     = "{dir}"
+	relpathPlaceholder = "{relpath}"
+	pathsPlaceholder   = "{paths}"
+)
+
+// IsPerPath returns true if the args contain any placeholder that refers to a
+// single path. A command with these placeholders must be run once per path.
+func IsPerPath(args []string) bool {
+	for _, a := range args {
+		if strings.Contains(a, pathPlaceholder) ||
+			strings.Contains(a, dirPlaceholder) ||
+			strings.Contains(a, relpathPlaceholder) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPlaceholder returns true if the args contain any per-invocation
+// placeholder at all. If they do not, the caller is responsible for deciding
+// where the paths go.
+func HasPlaceholder(args []string) bool {
+	if IsPerPath(args) {
+		return true
+	}
+	for _, a := range args {
+		if strings.Contains(a, pathsPlaceholder) {
+			return true
+		}
+	}
+	return false
+}
+
+// ForInvocation replaces the per-invocation placeholders in args. The paths
+// are relative to dir, which is where the command runs, unless they are
+// absolute. The {path}, {dir}, and {relpath} placeholders use the first path,
+// so commands that use them should be called with one path at a time. The
+// {relpath} placeholder is always relative to the root. An argument that is
+// exactly {paths} becomes one argument per path, while {paths} embedded in a
+// larger argument is replaced by the paths joined with spaces, as it is by
+// ForValue.
+func ForInvocation(args []string, root, dir string, paths []string) []string {
+	replacer := newReplacer(root, dir, paths)
+
+	expanded := []string{}
+	for _, a := range args {
+		if a == pathsPlaceholder {
+			expanded = append(expanded, paths...)
+			continue
+		}
+		expanded = append(expanded, replacer.Replace(a))
+	}
+
+	return expanded
+}
+
+// ForValue replaces the per-invocation placeholders in a single value, like
+// an env var or a path_prepend entry, which can't be split into several
+// arguments. The {paths} placeholder is always replaced by the paths joined
+// with spaces.
+func ForValue(s, root, dir string, paths []string) string {
+	return newReplacer(root, dir, paths).Replace(s)
+}
+
+func newReplacer(root, dir string, paths []string) *strings.Replacer {
+	var path, pathDir, rel string
+	if len(paths) > 0 {
+		path = paths[0]
+		pathDir = filepath.Dir(path)
+		rel = path
+		abs := path
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(dir, abs)
+		}
+		if root != "" {
+			if r, err := filepath.Rel(root, abs); err == nil {
+				rel = r
+			}
+		}
+	}
+
+	return strings.NewReplacer(
+		pathPlaceholder, path,
+		dirPlaceholder, pathDir,
+		relpathPlaceholder, rel,
+		pathsPlaceholder, strings.Join(paths, " "),
+	)
+}
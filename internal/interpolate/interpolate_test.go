@@ -0,0 +1,68 @@
+package interpolate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestForInvocation(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		paths []string
+		want  []string
+	}{
+		{
+			name:  "whole paths argument",
+			args:  []string{"tool", "{paths}"},
+			paths: []string{"a.go", "b c.go"},
+			want:  []string{"tool", "a.go", "b c.go"},
+		},
+		{
+			name:  "embedded paths",
+			args:  []string{"tool", "--files={paths}"},
+			paths: []string{"a.go", "b.go"},
+			want:  []string{"tool", "--files=a.go b.go"},
+		},
+		{
+			name:  "per path placeholders",
+			args:  []string{"tool", "--in={path}", "--dir={dir}", "{relpath}"},
+			paths: []string{"sub/a.go"},
+			want:  []string{"tool", "--in=sub/a.go", "--dir=sub", "proj/sub/a.go"},
+		},
+		{
+			name:  "no paths",
+			args:  []string{"tool", "{paths}", "x{path}"},
+			paths: []string{},
+			want:  []string{"tool", "x"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ForInvocation(test.args, "/root", "/root/proj", test.paths)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ForInvocation(%q) = %q, want %q", test.args, got, test.want)
+			}
+		})
+	}
+}
+
+func TestForValue(t *testing.T) {
+	tests := []struct {
+		value string
+		paths []string
+		want  string
+	}{
+		{"{paths}", []string{"a.go", "b.go"}, "a.go b.go"},
+		{"{path}", []string{"sub/a.go"}, "sub/a.go"},
+		{"{dir}/bin", []string{"sub/a.go"}, "sub/bin"},
+		{"no placeholders", []string{"a.go"}, "no placeholders"},
+	}
+
+	for _, test := range tests {
+		if got := ForValue(test.value, "/root", "/root", test.paths); got != test.want {
+			t.Errorf("ForValue(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package issue
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRegex matches the "path:line:column: message" format that compilers
+// and many linters use. The column is optional.
+const DefaultRegex = `^(?P<path>[^:\s][^:]*):(?P<line>\d+):(?:(?P<column>\d+):)?\s*(?P<message>.*)$`
+
+// Issue is a single problem reported by a linter.
+type Issue struct {
+	Path    string
+	Line    int
+	Column  int
+	Message string
+	// Text is the line of output the issue was parsed from.
+	Text string
+}
+
+// Parser finds issues in a linter's output using a regex with named groups.
+// The "path" and "line" groups are required, and "column" and "message" are
+// optional.
+type Parser struct {
+	re *regexp.Regexp
+}
+
+func NewParser(pattern string) (*Parser, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "The issue regex is not valid")
+	}
+
+	names := map[string]bool{}
+	for _, n := range re.SubexpNames() {
+		names[n] = true
+	}
+	for _, n := range []string{"path", "line"} {
+		if !names[n] {
+			return nil, errors.Errorf("The issue regex must have a named group for the %s, like (?P<%s>...)", n, n)
+		}
+	}
+
+	return &Parser{re}, nil
+}
+
+// Parse returns the issues found in the output, along with the lines that
+// were not issues. Relative paths are resolved against dir.
+func (p *Parser) Parse(output, dir string) ([]*Issue, []string) {
+	issues := []*Issue{}
+	other := []string{}
+	for _, l := range strings.Split(output, "\n") {
+		l = strings.TrimSuffix(l, "\r")
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+
+		i := p.parseLine(l, dir)
+		if i == nil {
+			other = append(other, l)
+			continue
+		}
+		issues = append(issues, i)
+	}
+
+	return issues, other
+}
+
+func (p *Parser) parseLine(l, dir string) *Issue {
+	m := p.re.FindStringSubmatch(l)
+	if m == nil {
+		return nil
+	}
+
+	i := &Issue{Text: l}
+	for n, name := range p.re.SubexpNames() {
+		switch name {
+		case "path":
+			i.Path = m[n]
+		case "line":
+			i.Line, _ = strconv.Atoi(m[n])
+		case "column":
+			i.Column, _ = strconv.Atoi(m[n])
+		case "message":
+			i.Message = m[n]
+		}
+	}
+	if i.Path == "" || i.Line == 0 {
+		return nil
+	}
+
+	if !filepath.IsAbs(i.Path) {
+		i.Path = filepath.Join(dir, i.Path)
+	}
+	i.Path = filepath.Clean(i.Path)
+
+	return i
+}
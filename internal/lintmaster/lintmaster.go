@@ -0,0 +1,139 @@
+package lintmaster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	alog "github.com/apex/log"
+	"github.com/houseabsolute/precious/internal/basepaths"
+	"github.com/houseabsolute/precious/internal/config"
+	"github.com/houseabsolute/precious/internal/filter"
+	"github.com/houseabsolute/precious/internal/issue"
+	"github.com/houseabsolute/precious/internal/runner"
+)
+
+type LintMaster struct {
+	l  *alog.Logger
+	c  *config.Config
+	bp *basepaths.BasePaths
+	// If this is true, only issues on lines that were changed according to
+	// git are reported.
+	newIssuesOnly bool
+	margin        int
+	changes       basepaths.Changes
+}
+
+func New(l *alog.Logger, c *config.Config, bp *basepaths.BasePaths) (*LintMaster, error) {
+	return &LintMaster{l: l, c: c, bp: bp}, nil
+}
+
+// SetNewIssuesOnly makes the LintMaster ignore issues that are not within
+// margin lines of a line that was added or modified according to git.
+func (lm *LintMaster) SetNewIssuesOnly(margin int) {
+	lm.newIssuesOnly = true
+	lm.margin = margin
+}
+
+// Lint runs each linting filter on the paths it applies to, in the order the
+// filters are defined in the config. It returns the most severe outcome of
+// any filter. If the context is cancelled, the context's error is returned.
+func (lm *LintMaster) Lint(ctx context.Context) (filter.Outcome, error) {
+	err := runner.FindPaths(lm.bp)
+	if err != nil {
+		return filter.Errored, err
+	}
+	if lm.newIssuesOnly {
+		lm.changes, err = lm.bp.ChangedLines()
+		if err != nil {
+			return filter.Errored, err
+		}
+	}
+
+	outcome := filter.Passed
+	for _, f := range runner.Filters(lm.l, lm.c, filter.Lint) {
+		o, err := lm.lint(ctx, f)
+		if err != nil {
+			return filter.Errored, err
+		}
+		if o > outcome {
+			outcome = o
+		}
+	}
+
+	return outcome, nil
+}
+
+func (lm *LintMaster) lint(ctx context.Context, f *filter.Filter) (filter.Outcome, error) {
+	matched, err := runner.MatchPaths(lm.l, lm.bp, f)
+	if err != nil {
+		return filter.Errored, err
+	}
+	if len(matched) == 0 {
+		return filter.Passed, nil
+	}
+
+	lm.l.Infof("Linting %d path(s) with %s", len(matched), f.Name())
+	results, err := f.Lint(ctx, matched)
+	if err != nil {
+		return filter.Errored, err
+	}
+
+	outcome := filter.Passed
+	for _, r := range results {
+		o := f.Classify(r)
+		out := runner.Output(r)
+		if o == filter.Failed && lm.newIssuesOnly {
+			o, out = lm.onlyNewIssues(f, r)
+		}
+		if o > outcome {
+			outcome = o
+		}
+
+		lm.logResult(f, r, o, out)
+	}
+
+	return outcome, nil
+}
+
+// The out is the part of the filter's output to show for a lint failure.
+func (lm *LintMaster) logResult(f *filter.Filter, r *filter.Result, o filter.Outcome, out string) {
+	failure := fmt.Sprintf("The %s filter found problems in %s%s", f.Name(), strings.Join(r.Paths, ", "), out)
+	runner.LogResult(lm.l, f, r, o, failure)
+}
+
+// Only lint failures are filtered, never tool errors. If we can't find any
+// issues in the output we report all of it rather than risk hiding a real
+// problem.
+func (lm *LintMaster) onlyNewIssues(f *filter.Filter, r *filter.Result) (filter.Outcome, string) {
+	re := f.IssueRegex
+	if re == "" {
+		re = issue.DefaultRegex
+	}
+	p, err := issue.NewParser(re)
+	if err != nil {
+		lm.l.Errorf("%s", err)
+		return filter.Failed, runner.Output(r)
+	}
+
+	issues, _ := p.Parse(r.Stdout+"\n"+r.Stderr, r.Dir)
+	if len(issues) == 0 {
+		lm.l.Warnf("Could not find any issues in the output of the %s filter, so all of its output is reported", f.Name())
+		return filter.Failed, runner.Output(r)
+	}
+
+	kept := []string{}
+	for _, i := range issues {
+		if lm.changes.Contains(i.Path, i.Line, lm.margin) {
+			kept = append(kept, i.Text)
+		}
+	}
+	if ignored := len(issues) - len(kept); ignored > 0 {
+		lm.l.Infof("Ignoring %d issue(s) from the %s filter on lines that were not changed", ignored, f.Name())
+	}
+	if len(kept) == 0 {
+		return filter.Passed, ""
+	}
+
+	return filter.Failed, "\n" + strings.Join(kept, "\n")
+}
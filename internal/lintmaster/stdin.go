@@ -0,0 +1,71 @@
+package lintmaster
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/houseabsolute/precious/internal/filter"
+	"github.com/houseabsolute/precious/internal/runner"
+	"github.com/houseabsolute/precious/internal/stdin"
+	"github.com/pkg/errors"
+)
+
+// LintStdin lints content read from stdin as if it were the file at the
+// virtual path. Filters are selected based on the virtual path. The output
+// of each filter that finds problems is written to w, with the virtual path
+// in place of the temporary file's path, so an editor can parse it.
+func (lm *LintMaster) LintStdin(ctx context.Context, virtual string, content []byte, w io.Writer) (filter.Outcome, error) {
+	sf, err := stdin.New(virtual, content)
+	if err != nil {
+		return filter.Errored, err
+	}
+	defer func() {
+		err := sf.Cleanup()
+		if err != nil {
+			lm.l.Errorf("%+v", err)
+		}
+	}()
+
+	outcome := filter.Passed
+	for _, f := range runner.Filters(lm.l, lm.c, filter.Lint) {
+		reason, err := sf.Explain(lm.bp, f)
+		if err != nil {
+			return filter.Errored, err
+		}
+		if reason != "" {
+			lm.l.Debugf("Not linting %s with %s because %s", virtual, f.Name(), reason)
+			continue
+		}
+
+		lm.l.Infof("Linting %s with %s", virtual, f.Name())
+		results, err := f.Lint(ctx, []string{sf.Path})
+		if err != nil {
+			return filter.Errored, err
+		}
+
+		for _, r := range results {
+			o := f.Classify(r)
+			if o > outcome {
+				outcome = o
+			}
+
+			r = sf.RewriteResult(r)
+			lm.logResult(f, r, o, "")
+			if o != filter.Failed {
+				continue
+			}
+			for _, out := range []string{r.Stdout, r.Stderr} {
+				if strings.TrimSpace(out) == "" {
+					continue
+				}
+				_, err := io.WriteString(w, strings.TrimRight(out, "\n")+"\n")
+				if err != nil {
+					return filter.Errored, errors.Wrap(err, "Could not write the lint output")
+				}
+			}
+		}
+	}
+
+	return outcome, nil
+}
@@ -2,54 +2,88 @@ package pathfilter
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/houseabsolute/precious/internal/filetype"
+	"github.com/houseabsolute/precious/internal/gitignore"
+	"github.com/houseabsolute/precious/internal/gitrepo"
+	"github.com/houseabsolute/precious/internal/skip"
 	zglob "github.com/mattn/go-zglob"
 	"github.com/pkg/errors"
-	gitignore "github.com/sabhiram/go-gitignore"
 )
 
+// TypePrefix marks an include or exclude entry as a reference to a named file
+// type rather than a zglob pattern, as in "type:perl".
+const TypePrefix = "type:"
+
 type Filter struct {
+	// Relative zglob patterns are matched against paths relative to this.
+	root string
+	// Each entry is either a zglob pattern or a type reference.
 	include []string
 	exclude []string
-	// This is a map of directories to gitignore(-style) files. The directory
-	// root will be stripped from a file when checking it with each ignorer so
-	// that "/foo" style ignores are handled correctly.
-	ignore map[string]*gitignore.GitIgnore
+	types   *filetype.Registry
+	// Each gitignore(-style) file applies to the directory it is in, just
+	// like a .gitignore file.
+	ignore *gitignore.Matcher
+	rules  skip.Rules
+	// This records why paths that matched the include and exclude rules
+	// were skipped because of their content or size.
+	skipped map[string]string
 }
 
-func New(include, exclude, ignoreFiles []string) (*Filter, error) {
-	ignore := map[string]*gitignore.GitIgnore{}
-	if ignoreFiles != nil {
-		for _, f := range ignoreFiles {
-			i, err := gitignore.CompileIgnoreFile(f)
-			if err != nil {
-				return nil, errors.Wrap(err, fmt.Sprintf("Could not compile gitignore style file at %s", f))
-			}
-			ignore[filepath.Dir(f)] = i
+// New returns a Filter. The includeTypes are the same as include entries
+// with the TypePrefix. If types is nil, only the built-in types are
+// available. Paths that match the rules are still skipped if their content
+// or size matches the skip rules.
+func New(root string, types *filetype.Registry, include, includeTypes, exclude, ignoreFiles []string, rules skip.Rules) (*Filter, error) {
+	if types == nil {
+		types = filetype.NewRegistry()
+	}
+
+	include = append([]string{}, include...)
+	for _, t := range includeTypes {
+		include = append(include, TypePrefix+t)
+	}
+
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not get abs path for %s", root))
+	}
+
+	ignore, err := gitignore.New(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range ignoreFiles {
+		err := ignore.AddFile(f)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Could not compile gitignore style file at %s", f))
 		}
 	}
 
-	return &Filter{include, exclude, ignore}, nil
+	return &Filter{
+		root:    abs,
+		include: include,
+		exclude: exclude,
+		types:   types,
+		ignore:  ignore,
+		rules:   rules,
+		skipped: map[string]string{},
+	}, nil
 }
 
 func (f *Filter) ApplyAllRules(paths []string) ([]string, error) {
 	filtered := []string{}
 	for _, path := range paths {
-		exclude, err := f.pathIsExcluded(path)
+		reason, err := f.Explain(path)
 		if err != nil {
 			return []string{}, err
 		}
-		if exclude {
-			continue
-		}
-
-		include, err := f.pathIsIncluded(path)
-		if err != nil {
-			return []string{}, err
-		}
-		if !include {
+		if reason != "" {
 			continue
 		}
 
@@ -59,6 +93,46 @@ func (f *Filter) ApplyAllRules(paths []string) ([]string, error) {
 	return filtered, nil
 }
 
+// Explain returns the reason the path does not pass the rules, or an empty
+// string if it does.
+func (f *Filter) Explain(path string) (string, error) {
+	return f.ExplainAs(path, path)
+}
+
+// ExplainAs is like Explain, except that the rules that look at a file's
+// content or size look at contentPath instead. This is used for content that
+// is not at its real path, like content read from stdin.
+func (f *Filter) ExplainAs(path, contentPath string) (string, error) {
+	reason, err := f.ExcludeReasonAs(path, contentPath)
+	if err != nil || reason != "" {
+		return reason, err
+	}
+
+	include, err := f.pathIsIncluded(path, contentPath)
+	if err != nil {
+		return "", err
+	}
+	if !include {
+		return "it does not match any include pattern or type", nil
+	}
+
+	reason, err = f.rules.Reason(contentPath)
+	if err != nil {
+		return "", err
+	}
+	if reason != "" {
+		f.skipped[path] = reason
+	}
+
+	return reason, nil
+}
+
+// Skipped returns the paths that were skipped because of the skip rules,
+// mapped to the reason they were skipped.
+func (f *Filter) Skipped() map[string]string {
+	return f.skipped
+}
+
 func (f *Filter) ApplyExcludeRules(paths []string) ([]string, error) {
 	filtered := []string{}
 	for _, path := range paths {
@@ -76,30 +150,40 @@ func (f *Filter) ApplyExcludeRules(paths []string) ([]string, error) {
 }
 
 func (f *Filter) pathIsExcluded(path string) (bool, error) {
-	for d, i := range f.ignore {
-		if strings.HasPrefix(d, path) {
-			if i.MatchesPath(strings.TrimPrefix(path, d)) {
-				return true, nil
-			}
-		}
+	reason, err := f.ExcludeReason(path)
+	return reason != "", err
+}
+
+// ExcludeReason returns the reason the path is excluded or ignored, or an
+// empty string if it is not.
+func (f *Filter) ExcludeReason(path string) (string, error) {
+	return f.ExcludeReasonAs(path, path)
+}
+
+// ExcludeReasonAs is like ExcludeReason, except that file types are detected
+// from the content at contentPath.
+func (f *Filter) ExcludeReasonAs(path, contentPath string) (string, error) {
+	fi, err := os.Stat(path)
+	if f.ignore.Ignored(path, err == nil && fi.IsDir()) {
+		return "it is ignored by an ignore file", nil
 	}
 
 	for _, e := range f.exclude {
-		matched, err := checkZglob(e, path)
+		matched, err := f.matches(e, path, contentPath)
 		if err != nil {
-			return false, err
+			return "", err
 		}
 		if matched {
-			return true, nil
+			return fmt.Sprintf("it matches the exclude entry %s", e), nil
 		}
 	}
 
-	return false, nil
+	return "", nil
 }
 
-func (f *Filter) pathIsIncluded(path string) (bool, error) {
+func (f *Filter) pathIsIncluded(path, contentPath string) (bool, error) {
 	for _, i := range f.include {
-		matched, err := checkZglob(i, path)
+		matched, err := f.matches(i, path, contentPath)
 		if err != nil {
 			return false, err
 		}
@@ -111,6 +195,35 @@ func (f *Filter) pathIsIncluded(path string) (bool, error) {
 	return false, nil
 }
 
+func (f *Filter) matches(entry, path, contentPath string) (bool, error) {
+	if strings.HasPrefix(entry, TypePrefix) {
+		return f.types.MatchesAs(path, contentPath, strings.TrimPrefix(entry, TypePrefix))
+	}
+	return checkZglob(entry, f.globPath(entry, path))
+}
+
+// Paths can be given to us relative to the cwd, as they are on the command
+// line, or as absolute paths, as they are when we find them ourselves. A
+// pattern like "vendor/**/*" must match the same files either way, so we
+// match relative patterns against the path relative to the root. A pattern
+// that is absolute, for example because it starts with $ROOT, is matched
+// against the absolute path.
+func (f *Filter) globPath(pattern, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if filepath.IsAbs(pattern) {
+		return abs
+	}
+
+	rel, ok := gitrepo.Relative(f.root, abs)
+	if !ok || rel == "" {
+		return abs
+	}
+	return rel
+}
+
 func checkZglob(pattern, path string) (bool, error) {
 	matched, err := zglob.Match(pattern, path)
 	if err != nil {
@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	alog "github.com/apex/log"
+	"github.com/houseabsolute/precious/internal/basepaths"
+	"github.com/houseabsolute/precious/internal/config"
+	"github.com/houseabsolute/precious/internal/filter"
+	"github.com/houseabsolute/precious/internal/pathfilter"
+)
+
+// FindPaths finds all the paths up front so that problems like a missing
+// path are reported before any filter runs.
+func FindPaths(bp *basepaths.BasePaths) error {
+	_, err := bp.Paths()
+	return err
+}
+
+// Filters returns the selected filters of the given type, plus any filters
+// that both tidy and lint, in the order they are defined in the config.
+// Language server filters are skipped with a warning.
+func Filters(l *alog.Logger, c *config.Config, typ filter.FilterType) []*filter.Filter {
+	filters := []*filter.Filter{}
+	for _, f := range c.Filters() {
+		if f.Type != typ && f.Type != filter.Both {
+			continue
+		}
+		if f.Server != nil {
+			l.Warnf("Skipping the %s filter because running language servers is not supported yet", f.Name())
+			continue
+		}
+		filters = append(filters, f)
+	}
+	return filters
+}
+
+// MatchPaths returns the paths that the filter applies to. Any paths that it
+// skips because of their content are logged.
+func MatchPaths(l *alog.Logger, bp *basepaths.BasePaths, f *filter.Filter) ([]string, error) {
+	paths, err := bp.PathsFor(f.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	pf, err := pathfilter.New(f.Root, f.Types, f.Include, f.IncludeTypes, f.Exclude, f.Ignore, f.Skip)
+	if err != nil {
+		return nil, err
+	}
+
+	matched, err := pf.ApplyAllRules(paths)
+	if err != nil {
+		return nil, err
+	}
+	logSkipped(l, f, pf)
+	if len(matched) == 0 {
+		l.Debugf("No paths matched the %s filter", f.Name())
+	}
+
+	return matched, nil
+}
+
+// LogResult logs the result of running a filter. The failure is the message
+// for a result with the Failed outcome, which differs between tidying and
+// linting.
+func LogResult(l *alog.Logger, f *filter.Filter, r *filter.Result, o filter.Outcome, failure string) {
+	cmd := strings.Join(r.Argv, " ")
+	switch {
+	case r.Skipped:
+		l.Warnf("Skipping the %s filter for %s: %s", f.Name(), strings.Join(r.Paths, ", "), r.Err)
+	case r.Err != nil:
+		l.Errorf("%s", r.Err)
+	case r.TimedOut:
+		l.Errorf("The %s filter timed out after %d attempt(s) running %s", f.Name(), r.Attempts, cmd)
+	case o == filter.Failed:
+		l.Errorf("%s", failure)
+	case o == filter.Errored:
+		l.Errorf("The %s filter exited unexpectedly with %d running %s%s", f.Name(), r.ExitCode, cmd, Output(r))
+	default:
+		l.Debugf("Ran %s", cmd)
+	}
+}
+
+// Output returns the filter's stdout and stderr, each with a heading, or an
+// empty string if there was no output.
+func Output(r *filter.Result) string {
+	out := ""
+	if s := strings.TrimSpace(r.Stdout); s != "" {
+		out += fmt.Sprintf("\nstdout:\n%s", s)
+	}
+	if s := strings.TrimSpace(r.Stderr); s != "" {
+		out += fmt.Sprintf("\nstderr:\n%s", s)
+	}
+	return out
+}
+
+func logSkipped(l *alog.Logger, f *filter.Filter, pf *pathfilter.Filter) {
+	skipped := pf.Skipped()
+	paths := []string{}
+	for p := range skipped {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		l.Infof("Skipping %s for the %s filter because %s", p, f.Name(), skipped[p])
+	}
+}
@@ -0,0 +1,253 @@
+package scaffold
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	alog "github.com/apex/log"
+	"github.com/houseabsolute/precious/internal/basepaths"
+	"github.com/houseabsolute/precious/internal/filetype"
+	"github.com/pkg/errors"
+)
+
+type language struct {
+	name string
+	// This is the name of the language's type in the filetype package.
+	typ string
+}
+
+var languages = []language{
+	{"Go", "go"},
+	{"Perl", "perl"},
+	{"Python", "python"},
+	{"Ruby", "ruby"},
+	{"JavaScript", "javascript"},
+	{"TypeScript", "typescript"},
+	{"Shell", "shell"},
+	{"Rust", "rust"},
+}
+
+type tool struct {
+	name      string
+	typ       string
+	languages []string
+	cmd       []string
+	args      []string
+	onDir     bool
+}
+
+// These are well-known tidiers and linters. Tools that are not found in the
+// PATH are still included in the generated config, but commented out.
+var tools = []tool{
+	{"gofmt", "tidy", []string{"Go"}, []string{"gofmt", "-w"}, nil, false},
+	{"golangci-lint", "lint", []string{"Go"}, []string{"golangci-lint", "run"}, nil, true},
+	{"perltidy", "tidy", []string{"Perl"}, []string{"perltidy"}, []string{"--backup-and-modify-in-place", "--backup-file-extension=/"}, false},
+	{"perlcritic", "lint", []string{"Perl"}, []string{"perlcritic"}, nil, false},
+	{"black", "tidy", []string{"Python"}, []string{"black"}, nil, false},
+	{"flake8", "lint", []string{"Python"}, []string{"flake8"}, nil, false},
+	{"rubocop", "lint", []string{"Ruby"}, []string{"rubocop"}, nil, false},
+	{"prettier", "tidy", []string{"JavaScript", "TypeScript"}, []string{"prettier"}, []string{"--write"}, false},
+	{"eslint", "lint", []string{"JavaScript", "TypeScript"}, []string{"eslint"}, nil, false},
+	{"shfmt", "tidy", []string{"Shell"}, []string{"shfmt", "-w"}, nil, false},
+	{"shellcheck", "lint", []string{"Shell"}, []string{"shellcheck"}, nil, false},
+	{"rustfmt", "tidy", []string{"Rust"}, []string{"rustfmt"}, nil, false},
+}
+
+// Tally is the number of files found for a language.
+type Tally struct {
+	Language string
+	// ByExtension is the number of files matched by their name.
+	ByExtension int
+	// ByShebang is the number of files matched by their content, either a
+	// shebang line or a modeline.
+	ByShebang int
+}
+
+// Scan walks the directory tree under root and counts the files for each
+// language we know about. Anything ignored by git is skipped.
+func Scan(l *alog.Logger, root string) ([]*Tally, error) {
+	bp, err := basepaths.New(l, basepaths.FromCLI, root, nil, []string{root}, []string{"**/.hg/**", "**/.svn/**"}, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := bp.Paths()
+	if err != nil {
+		return nil, err
+	}
+
+	tallies := map[string]*Tally{}
+	for _, p := range paths {
+		lang, byShebang := detect(p)
+		if lang == "" {
+			continue
+		}
+
+		t, ok := tallies[lang]
+		if !ok {
+			t = &Tally{Language: lang}
+			tallies[lang] = t
+		}
+		if byShebang {
+			t.ByShebang++
+		} else {
+			t.ByExtension++
+		}
+	}
+
+	sorted := []*Tally{}
+	for _, lang := range languages {
+		if t, ok := tallies[lang.name]; ok {
+			l.Infof("Found %d %s file(s)", t.ByExtension+t.ByShebang, lang.name)
+			sorted = append(sorted, t)
+		}
+	}
+
+	return sorted, nil
+}
+
+func detect(path string) (string, bool) {
+	t, byContent, err := filetype.Detect(path)
+	if err != nil || t == nil {
+		return "", false
+	}
+
+	for _, lang := range languages {
+		if lang.typ == t.Name {
+			return lang.name, byContent
+		}
+	}
+
+	return "", false
+}
+
+// Config returns the text of a commented precious.toml for the languages in
+// the given tallies. It returns an error if none of the tallied languages
+// has a tool in the PATH, since a config without any filters is not valid.
+func Config(tallies []*Tally) (string, error) {
+	if len(tallies) == 0 {
+		return "", errors.New("No files in a language that precious init knows about were found, so there is nothing to configure. You will need to write a config by hand.")
+	}
+
+	found := map[string]*Tally{}
+	for _, t := range tallies {
+		found[t.Language] = t
+	}
+
+	var b strings.Builder
+	b.WriteString(`# This file was generated by "precious init". Filters for tools that were
+# not found in your PATH are commented out. Review the include globs and args
+# before using it.
+`)
+
+	enabled := 0
+	missing := []string{}
+	for _, tl := range tools {
+		langs := []string{}
+		for _, l := range tl.languages {
+			if _, ok := found[l]; ok {
+				langs = append(langs, l)
+			}
+		}
+		if len(langs) == 0 {
+			continue
+		}
+
+		if writeTool(&b, tl, langs, found) {
+			enabled++
+		} else {
+			missing = append(missing, tl.cmd[0])
+		}
+	}
+
+	if enabled == 0 {
+		return "", errors.Errorf(
+			"None of the tools that precious init knows about for your code were found in your PATH, so the config would not have any filters. Install one of these and try again: %s",
+			strings.Join(missing, ", "))
+	}
+
+	return b.String(), nil
+}
+
+// This returns false if the tool was not found, in which case it is written
+// commented out. Files without an extension, like scripts, can't be matched
+// by a glob, so if we found any for a language, its type is added to the
+// filter's include_types.
+func writeTool(b *strings.Builder, tl tool, langs []string, found map[string]*Tally) bool {
+	globs := []string{}
+	types := []string{}
+	for _, name := range langs {
+		for _, e := range filetype.Lookup(languageType(name)).Extensions {
+			globs = append(globs, "**/*"+e)
+		}
+		if found[name].ByShebang > 0 {
+			types = append(types, languageType(name))
+		}
+	}
+	sort.Strings(globs)
+
+	fmt.Fprintf(b, "\n# %s %s %s\n", tl.name, tidyOrLint(tl.typ), strings.Join(langs, " and "))
+	for _, name := range langs {
+		if n := found[name].ByShebang; n > 0 {
+			fmt.Fprintf(b, "# %d %s file(s) were detected by their shebang line or modeline.\n", n, name)
+		}
+	}
+
+	inPath := true
+	prefix := ""
+	if _, err := exec.LookPath(tl.cmd[0]); err != nil {
+		inPath = false
+		prefix = "# "
+		fmt.Fprintf(b, "# (commented out because %s was not found in your PATH)\n", tl.cmd[0])
+	}
+	fmt.Fprintf(b, "%s[[commands]]\n", prefix)
+	fmt.Fprintf(b, "  %s[[commands.%s]]\n", prefix, tl.name)
+	fmt.Fprintf(b, "  %stype    = %q\n", prefix, tl.typ)
+	fmt.Fprintf(b, "  %sinclude = %s\n", prefix, tomlStrings(globs))
+	if len(types) != 0 {
+		fmt.Fprintf(b, "  %sinclude_types = %s\n", prefix, tomlArray(types))
+	}
+	fmt.Fprintf(b, "  %scmd     = %s\n", prefix, tomlStrings(tl.cmd))
+	if len(tl.args) != 0 {
+		fmt.Fprintf(b, "  %sargs    = %s\n", prefix, tomlStrings(tl.args))
+	}
+	if tl.onDir {
+		fmt.Fprintf(b, "  %son_dir  = true\n", prefix)
+	}
+	fmt.Fprintf(b, "  %sok_exit_codes = 0\n", prefix)
+
+	return inPath
+}
+
+func languageType(name string) string {
+	for _, lang := range languages {
+		if lang.name == name {
+			return lang.typ
+		}
+	}
+	return ""
+}
+
+func tidyOrLint(typ string) string {
+	if typ == "tidy" {
+		return "tidies"
+	}
+	return "lints"
+}
+
+func tomlStrings(vals []string) string {
+	if len(vals) == 1 {
+		return fmt.Sprintf("%q", vals[0])
+	}
+	return tomlArray(vals)
+}
+
+func tomlArray(vals []string) string {
+	quoted := []string{}
+	for _, v := range vals {
+		quoted = append(quoted, fmt.Sprintf("%q", v))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
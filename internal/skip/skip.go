@@ -0,0 +1,135 @@
+package skip
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// GeneratedRE matches the marker that Go's tools put in generated files, as
+// described at https://golang.org/s/generatedcode. Many other code
+// generators use the same marker.
+var GeneratedRE = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// DefaultGeneratedLines is how many lines at the start of a file are checked
+// for the generated marker by default.
+const DefaultGeneratedLines = 10
+
+// How much of a file we read to decide whether it is binary. This is the
+// same heuristic git uses.
+const binaryCheckSize = 8000
+
+// Rules describe files that are skipped because of their content or size,
+// regardless of whether they match a filter's include patterns.
+type Rules struct {
+	// Generated files have a line matching GeneratedRegex in their first
+	// GeneratedLines lines.
+	Generated      bool
+	GeneratedRegex *regexp.Regexp
+	GeneratedLines int
+	// Binary files have a NUL byte near the start.
+	Binary bool
+	// MaxSize is in bytes. Zero means there is no limit.
+	MaxSize int64
+}
+
+// Default returns the rules used when the config doesn't set any. Nothing is
+// skipped, but the generated marker and line count are set so that turning
+// on Generated does the right thing.
+func Default() Rules {
+	return Rules{
+		GeneratedRegex: GeneratedRE,
+		GeneratedLines: DefaultGeneratedLines,
+	}
+}
+
+// Reason returns the reason the file at path should be skipped, or an empty
+// string if it should not be. Directories are never skipped.
+func (r Rules) Reason(path string) (string, error) {
+	if !r.Generated && !r.Binary && r.MaxSize == 0 {
+		return "", nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("Could not open %s", path))
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("Could not stat %s", path))
+	}
+	if !fi.Mode().IsRegular() {
+		return "", nil
+	}
+
+	if r.MaxSize > 0 && fi.Size() > r.MaxSize {
+		return fmt.Sprintf("it is %d bytes, which is larger than the limit of %d bytes", fi.Size(), r.MaxSize), nil
+	}
+
+	if r.Binary {
+		head := make([]byte, binaryCheckSize)
+		n, err := io.ReadFull(f, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return "", errors.Wrap(err, fmt.Sprintf("Could not read %s", path))
+		}
+		if bytes.IndexByte(head[:n], 0) != -1 {
+			return "it looks like a binary file", nil
+		}
+
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return "", errors.Wrap(err, fmt.Sprintf("Could not seek in %s", path))
+		}
+	}
+
+	if r.Generated && r.GeneratedRegex != nil {
+		s := bufio.NewScanner(f)
+		for i := 1; i <= r.GeneratedLines && s.Scan(); i++ {
+			if r.GeneratedRegex.MatchString(s.Text()) {
+				return fmt.Sprintf("it looks like a generated file (line %d matches %s)", i, r.GeneratedRegex), nil
+			}
+		}
+		// A line that is too long for the scanner is not a marker, and
+		// anything else was reported when the file was read above.
+		if err := s.Err(); err != nil && err != bufio.ErrTooLong {
+			return "", errors.Wrap(err, fmt.Sprintf("Could not read %s", path))
+		}
+	}
+
+	return "", nil
+}
+
+var sizeRE = regexp.MustCompile(`^(?i)(\d+)\s*(?:([kmg])i?)?b?$`)
+
+// ParseSize parses a size like "512", "100K", "2MB", or "1GiB". The suffixes
+// are all powers of 1024.
+func ParseSize(s string) (int64, error) {
+	m := sizeRE.FindStringSubmatch(s)
+	if m == nil {
+		return 0, errors.Errorf(`%q is not a valid size. Use a number of bytes, optionally followed by K, M, or G, like "512K"`, s)
+	}
+
+	var n int64
+	_, err := fmt.Sscan(m[1], &n)
+	if err != nil {
+		return 0, errors.Wrap(err, fmt.Sprintf("Could not parse the number in %q", s))
+	}
+
+	switch m[2] {
+	case "k", "K":
+		n *= 1 << 10
+	case "m", "M":
+		n *= 1 << 20
+	case "g", "G":
+		n *= 1 << 30
+	}
+
+	return n, nil
+}
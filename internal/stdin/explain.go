@@ -0,0 +1,29 @@
+package stdin
+
+import (
+	"github.com/houseabsolute/precious/internal/basepaths"
+	"github.com/houseabsolute/precious/internal/filter"
+	"github.com/houseabsolute/precious/internal/pathfilter"
+)
+
+// Explain returns the reason the filter does not apply to the virtual path,
+// or an empty string if it does. This checks the global rules as well as the
+// filter's own rules. Rules that look at a file's content use the temporary
+// file, so the virtual path does not need to exist.
+func (f *File) Explain(bp *basepaths.BasePaths, flt *filter.Filter) (string, error) {
+	reason, err := bp.ExplainAs(f.Virtual, f.Path)
+	if err != nil || reason != "" {
+		return reason, err
+	}
+
+	if reason := bp.ExplainFilter(f.Virtual, flt.Name()); reason != "" {
+		return reason, nil
+	}
+
+	pf, err := pathfilter.New(flt.Root, flt.Types, flt.Include, flt.IncludeTypes, flt.Exclude, flt.Ignore, flt.Skip)
+	if err != nil {
+		return "", err
+	}
+
+	return pf.ExplainAs(f.Virtual, f.Path)
+}
@@ -0,0 +1,124 @@
+package stdin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/houseabsolute/precious/internal/basepaths"
+	"github.com/houseabsolute/precious/internal/filter"
+	"github.com/pkg/errors"
+)
+
+// File is a temporary copy of content read from stdin, for tools that only
+// work on files. The copy has the same basename as the virtual path the
+// content belongs to. If the virtual path's directory exists, the copy is
+// put in a new directory inside it rather than in the system temp dir. Many
+// tools look for their config in the file's parent directories, and a
+// working_dir of "nearest:<marker file>" does the same, so the copy has to
+// be in the tree to be treated the same way as the real file. The basepaths
+// package excludes these directories.
+type File struct {
+	Virtual string
+	Path    string
+	dir     string
+}
+
+// New writes the content to a temporary file for the given virtual path.
+func New(virtual string, content []byte) (*File, error) {
+	abs, err := filepath.Abs(virtual)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not get abs path for %s", virtual))
+	}
+
+	parent := filepath.Dir(abs)
+	if fi, err := os.Stat(parent); err != nil || !fi.IsDir() {
+		parent = ""
+	}
+
+	dir, err := ioutil.TempDir(parent, basepaths.StdinDirPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not create a temp dir for the content from stdin")
+	}
+
+	f := &File{
+		Virtual: abs,
+		Path:    filepath.Join(dir, filepath.Base(abs)),
+		dir:     dir,
+	}
+
+	err = ioutil.WriteFile(f.Path, content, 0644)
+	if err != nil {
+		f.Cleanup()
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not write the content from stdin to %s", f.Path))
+	}
+
+	return f, nil
+}
+
+// Content returns the current content of the temporary file.
+func (f *File) Content() ([]byte, error) {
+	content, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not read %s", f.Path))
+	}
+	return content, nil
+}
+
+// Rewrite replaces the temporary file's path with the virtual path in a
+// tool's output, so that messages refer to the file the user is editing.
+// Tools are passed the path relative to the directory they run in, so we
+// replace that form too.
+func (f *File) Rewrite(dir, output string) string {
+	output = strings.Replace(output, f.Path, f.Virtual, -1)
+	if dir == "" {
+		return output
+	}
+
+	rel, err := filepath.Rel(dir, f.Path)
+	if err != nil {
+		return output
+	}
+	virtual, err := filepath.Rel(dir, f.Virtual)
+	if err != nil {
+		virtual = f.Virtual
+	}
+	return strings.Replace(output, rel, virtual, -1)
+}
+
+// Cleanup removes the temporary file and its directory.
+func (f *File) Cleanup() error {
+	err := os.RemoveAll(f.dir)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Could not remove %s", f.dir))
+	}
+	return nil
+}
+
+// RewriteResult returns a copy of the result with the temporary file's path
+// replaced by the virtual path.
+func (f *File) RewriteResult(r *filter.Result) *filter.Result {
+	rewritten := *r
+	dir := ""
+	if r.Invocation != nil {
+		dir = r.Dir
+		inv := *r.Invocation
+		inv.Argv = f.rewriteAll(dir, inv.Argv)
+		inv.Paths = f.rewriteAll(dir, inv.Paths)
+		rewritten.Invocation = &inv
+	}
+	rewritten.Stdout = f.Rewrite(dir, r.Stdout)
+	rewritten.Stderr = f.Rewrite(dir, r.Stderr)
+
+	return &rewritten
+}
+
+func (f *File) rewriteAll(dir string, vals []string) []string {
+	rewritten := []string{}
+	for _, v := range vals {
+		rewritten = append(rewritten, f.Rewrite(dir, v))
+	}
+	return rewritten
+}
@@ -1,16 +0,0 @@
-package tidyer
-
-func New(
-	name string,
-	ignore []string,
-	include []string,
-	exclude []string,
-	typ string,
-	cmd []string,
-	args []string,
-	onDir bool,
-	server *server,
-	command *command,
-) (*Tidyer, error) {
-
-}
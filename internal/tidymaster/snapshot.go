@@ -0,0 +1,62 @@
+package tidymaster
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+type file struct {
+	content []byte
+	mode    os.FileMode
+}
+
+// A snapshot holds the content of a set of files before a tidier runs so
+// that they can be restored if the tidier is interrupted.
+type snapshot map[string]file
+
+func takeSnapshot(paths []string) (snapshot, error) {
+	snap := snapshot{}
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Could not stat %s", p))
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Could not read %s", p))
+		}
+		snap[p] = file{content, fi.Mode()}
+	}
+
+	return snap, nil
+}
+
+// Files that are unchanged are not rewritten.
+func (s snapshot) restore(paths []string) error {
+	for _, p := range paths {
+		f, ok := s[p]
+		if !ok {
+			continue
+		}
+
+		current, err := ioutil.ReadFile(p)
+		if err == nil && bytes.Equal(current, f.content) {
+			continue
+		}
+
+		err = ioutil.WriteFile(p, f.content, f.mode.Perm())
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Could not restore %s", p))
+		}
+	}
+
+	return nil
+}
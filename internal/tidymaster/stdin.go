@@ -0,0 +1,69 @@
+package tidymaster
+
+import (
+	"context"
+	"io"
+
+	"github.com/houseabsolute/precious/internal/filter"
+	"github.com/houseabsolute/precious/internal/runner"
+	"github.com/houseabsolute/precious/internal/stdin"
+	"github.com/pkg/errors"
+)
+
+// TidyStdin tidies content read from stdin as if it were the file at the
+// virtual path and writes the tidied content to w. Filters are selected
+// based on the virtual path. If any filter fails nothing is written, so an
+// editor never replaces a buffer with partially tidied content.
+func (tm *TidyMaster) TidyStdin(ctx context.Context, virtual string, content []byte, w io.Writer) (filter.Outcome, error) {
+	sf, err := stdin.New(virtual, content)
+	if err != nil {
+		return filter.Errored, err
+	}
+	defer func() {
+		err := sf.Cleanup()
+		if err != nil {
+			tm.l.Errorf("%+v", err)
+		}
+	}()
+
+	outcome := filter.Passed
+	for _, f := range runner.Filters(tm.l, tm.c, filter.Tidy) {
+		reason, err := sf.Explain(tm.bp, f)
+		if err != nil {
+			return filter.Errored, err
+		}
+		if reason != "" {
+			tm.l.Debugf("Not tidying %s with %s because %s", virtual, f.Name(), reason)
+			continue
+		}
+
+		tm.l.Infof("Tidying %s with %s", virtual, f.Name())
+		results, err := f.Tidy(ctx, []string{sf.Path})
+		if err != nil {
+			return filter.Errored, err
+		}
+
+		for _, r := range results {
+			o := f.Classify(r)
+			if o > outcome {
+				outcome = o
+			}
+			tm.logResult(f, sf.RewriteResult(r), o)
+		}
+	}
+
+	if outcome != filter.Passed {
+		return outcome, nil
+	}
+
+	tidied, err := sf.Content()
+	if err != nil {
+		return filter.Errored, err
+	}
+	_, err = w.Write(tidied)
+	if err != nil {
+		return filter.Errored, errors.Wrap(err, "Could not write the tidied content")
+	}
+
+	return outcome, nil
+}
@@ -1,9 +1,15 @@
 package tidymaster
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
 	alog "github.com/apex/log"
 	"github.com/houseabsolute/precious/internal/basepaths"
 	"github.com/houseabsolute/precious/internal/config"
+	"github.com/houseabsolute/precious/internal/filter"
+	"github.com/houseabsolute/precious/internal/runner"
 )
 
 type TidyMaster struct {
@@ -16,12 +22,83 @@ func New(l *alog.Logger, c *config.Config, bp *basepaths.BasePaths) (*TidyMaster
 	return &TidyMaster{l, c, bp}, nil
 }
 
-func (tm *TidyMaster) Tidy() error {
-	paths := tm.bp.Paths()
+// Tidy runs each tidying filter on the paths it applies to, in the order the
+// filters are defined in the config. It returns the most severe outcome of
+// any filter. If the context is cancelled, any files that the running filter
+// may have partially written are restored and the context's error is
+// returned.
+func (tm *TidyMaster) Tidy(ctx context.Context) (filter.Outcome, error) {
+	err := runner.FindPaths(tm.bp)
+	if err != nil {
+		return filter.Errored, err
+	}
+
+	outcome := filter.Passed
+	for _, f := range runner.Filters(tm.l, tm.c, filter.Tidy) {
+		o, err := tm.tidy(ctx, f)
+		if err != nil {
+			return filter.Errored, err
+		}
+		if o > outcome {
+			outcome = o
+		}
+	}
+
+	return outcome, nil
+}
+
+func (tm *TidyMaster) tidy(ctx context.Context, f *filter.Filter) (filter.Outcome, error) {
+	matched, err := runner.MatchPaths(tm.l, tm.bp, f)
+	if err != nil {
+		return filter.Errored, err
+	}
+	if len(matched) == 0 {
+		return filter.Passed, nil
+	}
 
-	for _, filter := range tm.c.Tidiers() {
-		filter.Tidy(paths)
+	snap, err := takeSnapshot(matched)
+	if err != nil {
+		return filter.Errored, err
 	}
 
-	return nil
+	tm.l.Infof("Tidying %d path(s) with %s", len(matched), f.Name())
+	results, err := f.Tidy(ctx, matched)
+	if err != nil {
+		for _, r := range results {
+			if r.Interrupted {
+				tm.l.Warnf("Restoring any files that the %s filter may have partially tidied", f.Name())
+				tm.restore(snap, r.Paths)
+			}
+		}
+		return filter.Errored, err
+	}
+
+	outcome := filter.Passed
+	for _, r := range results {
+		o := f.Classify(r)
+		if o > outcome {
+			outcome = o
+		}
+
+		tm.logResult(f, r, o)
+		if r.TimedOut {
+			tm.restore(snap, r.Paths)
+		}
+	}
+
+	return outcome, nil
+}
+
+func (tm *TidyMaster) logResult(f *filter.Filter, r *filter.Result, o filter.Outcome) {
+	failure := fmt.Sprintf("The %s filter failed running %s%s", f.Name(), strings.Join(r.Argv, " "), runner.Output(r))
+	runner.LogResult(tm.l, f, r, o, failure)
+}
+
+// A filter that was interrupted may have left a file half written, so we
+// put back what was there before it ran.
+func (tm *TidyMaster) restore(snap snapshot, paths []string) {
+	err := snap.restore(paths)
+	if err != nil {
+		tm.l.Errorf("%+v", err)
+	}
 }
@@ -0,0 +1,216 @@
+package trust
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type Status int
+
+const (
+	// Unknown means the config file has never been trusted.
+	Unknown Status = iota
+	// Changed means the config file was trusted, but its content has changed
+	// since then.
+	Changed
+	// Trusted means the config file's current content was trusted.
+	Trusted
+)
+
+// Store records which config files the user has trusted. Each trusted file
+// is stored in its own JSON file, named for a hash of the config file's path.
+// We keep the trusted content so we can show the user what changed.
+type Store struct {
+	dir string
+}
+
+type record struct {
+	Path    string `json:"path"`
+	Hash    string `json:"hash"`
+	Content string `json:"content"`
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir}
+}
+
+// Check returns the trust status of the given config file. If the file has
+// changed since it was trusted, it also returns a diff from the trusted
+// content to the current content.
+func (s *Store) Check(file string) (Status, string, error) {
+	path, content, err := read(file)
+	if err != nil {
+		return Unknown, "", err
+	}
+
+	rec, err := s.load(path)
+	if err != nil {
+		return Unknown, "", err
+	}
+	if rec == nil {
+		return Unknown, "", nil
+	}
+
+	if rec.Hash == hash(content) {
+		return Trusted, "", nil
+	}
+
+	return Changed, Diff(rec.Content, content), nil
+}
+
+// Trust records the current content of the given config file as trusted.
+func (s *Store) Trust(file string) error {
+	path, content, err := read(file)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(s.dir, 0700)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Could not create the trust store dir at %s", s.dir))
+	}
+
+	j, err := json.MarshalIndent(record{path, hash(content), content}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Could not encode trust record")
+	}
+
+	rf := s.recordFile(path)
+	err = ioutil.WriteFile(rf, j, 0600)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Could not write trust record to %s", rf))
+	}
+
+	return nil
+}
+
+func (s *Store) load(path string) (*record, error) {
+	rf := s.recordFile(path)
+	j, err := ioutil.ReadFile(rf)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not read trust record at %s", rf))
+	}
+
+	var rec record
+	err = json.Unmarshal(j, &rec)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not decode trust record at %s", rf))
+	}
+
+	// This would only happen with a hash collision or if someone edited the
+	// store by hand.
+	if rec.Path != path {
+		return nil, nil
+	}
+
+	return &rec, nil
+}
+
+func (s *Store) recordFile(path string) string {
+	return filepath.Join(s.dir, hash(path)+".json")
+}
+
+func read(file string) (string, string, error) {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return "", "", errors.Wrap(err, fmt.Sprintf("Could not get abs path for %s", file))
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", errors.Wrap(err, fmt.Sprintf("Could not read %s", path))
+	}
+
+	return path, string(content), nil
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Diff returns a line-based diff between two strings. Removed lines start
+// with "-", added lines with "+", and unchanged lines with a space. Only
+// unchanged lines near a change are included.
+func Diff(old, new string) string {
+	a := strings.Split(strings.TrimSuffix(old, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(new, "\n"), "\n")
+
+	// This is the classic longest common subsequence table. Config files are
+	// small so the quadratic size is not a concern.
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := []string{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+
+	return withContext(lines, 3)
+}
+
+func withContext(lines []string, context int) string {
+	keep := make([]bool, len(lines))
+	for i, l := range lines {
+		if l[0] == ' ' {
+			continue
+		}
+		for k := i - context; k <= i+context; k++ {
+			if k >= 0 && k < len(lines) {
+				keep[k] = true
+			}
+		}
+	}
+
+	var out strings.Builder
+	skipped := false
+	for i, l := range lines {
+		if !keep[i] {
+			skipped = true
+			continue
+		}
+		if skipped && out.Len() > 0 {
+			out.WriteString("  ...\n")
+		}
+		skipped = false
+		out.WriteString(l + "\n")
+	}
+
+	return out.String()
+}
@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	alog "github.com/apex/log"
 	clilog "github.com/apex/log/handlers/cli"
 	"github.com/houseabsolute/precious/internal/basepaths"
 	"github.com/houseabsolute/precious/internal/config"
+	"github.com/houseabsolute/precious/internal/doctor"
+	"github.com/houseabsolute/precious/internal/filter"
+	"github.com/houseabsolute/precious/internal/gitrepo"
+	"github.com/houseabsolute/precious/internal/lintmaster"
+	"github.com/houseabsolute/precious/internal/pathfilter"
+	"github.com/houseabsolute/precious/internal/scaffold"
 	"github.com/houseabsolute/precious/internal/tidymaster"
+	"github.com/houseabsolute/precious/internal/trust"
 	cli "github.com/jawher/mow.cli"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
@@ -39,13 +50,15 @@ servers, leaving them running in the background in order to speed up usage
 while you develop locally.
 `
 
-	app.Spec = "-c [-d | -v | -q]"
+	app.Spec = "[-c] [-p] [--trust] [-d | -v | -q]"
 	conf := app.StringOpt("c config", "", "Path to config file")
+	profile := app.StringOpt("p profile", "", "The config profile to use (can also be set with $"+profileEnvVar+")")
+	trustConfig := app.BoolOpt("trust", false, "Run the commands in the config file even if it has not been trusted")
 	verbose := app.BoolOpt("v verbose", false, "Enable verbose output")
 	debug := app.BoolOpt("d debug", false, "Enable debugging output")
 	quiet := app.BoolOpt("q quiet", false, "Suppress most output")
 
-	getRootArgs := func() (*alog.Logger, *config.Config) {
+	getLogger := func() *alog.Logger {
 		lvl := alog.InfoLevel
 		if *debug {
 			lvl = alog.DebugLevel
@@ -64,23 +77,59 @@ while you develop locally.
 			l.Debug("Enabling debug level output")
 		}
 
-		c := loadConfig(l, *conf)
+		return l
+	}
+
+	getConfigFile := func() (*alog.Logger, string) {
+		l := getLogger()
+		return l, findConfigFile(l, *conf)
+	}
+
+	getRootArgs := func() (*alog.Logger, *config.Config) {
+		l, file := getConfigFile()
+		checkTrust(l, file, *trustConfig)
+		c := loadConfig(l, file)
+		useProfile(l, c, *profile)
+
+		return l, c
+	}
+
+	// This is for commands that read the config without running anything
+	// from it, so they don't need to check whether it is trusted.
+	getUntrustedConfig := func() (*alog.Logger, *config.Config) {
+		l, file := getConfigFile()
+		c := loadConfig(l, file)
+		useProfile(l, c, *profile)
 
 		return l, c
 	}
 
 	app.Command("tidy", "Tidies the specified files/dirs", tidyCmd(getRootArgs))
 	app.Command("lint", "Lints the specified files/dirs", lintCmd(getRootArgs))
+	app.Command("config", "Commands for working with the config file", configCmd())
+	app.Command("init", "Writes a starter config for the languages found in this directory", initCmd(getLogger))
+	app.Command("trust", "Trusts the config file so that precious will run the commands it contains", trustCmd(getConfigFile))
+	app.Command("doctor", "Checks that the tools and files your config needs are available", doctorCmd(getRootArgs))
+	app.Command("types", "Lists the file types that filters can refer to", typesCmd(getConfigFile))
+	app.Command("explain", "Explains which filters apply to the given paths and why", explainCmd(getUntrustedConfig))
 
 	app.Run(os.Args)
 }
 
-// There's lots of others but I'm feeling lazy at the moment. PRs welcome to
-// add more to this list.
-var vcsDirs = []string{".git", ".hg", ".svn"}
+// These are the files or directories that mark the root of a checkout for
+// various VCS tools. Fossil uses a file rather than a directory.
+var vcsDirs = []string{".git", ".hg", ".svn", ".bzr", "_darcs", ".fossil", ".fslckout", "_FOSSIL_", ".jj", ".pijul"}
 
+// A submodule is part of its superproject's checkout, so we only treat it
+// as a root if it has its own config file.
 func isCheckoutRoot(dir string) bool {
 	for _, vcs := range vcsDirs {
+		if vcs == ".git" {
+			if gitrepo.IsRoot(dir) && (!gitrepo.IsSubmodule(dir) || hasConfigFile(dir)) {
+				return true
+			}
+			continue
+		}
 		_, err := os.Stat(filepath.Join(dir, vcs))
 		if err == nil {
 			return true
@@ -89,110 +138,666 @@ func isCheckoutRoot(dir string) bool {
 	return false
 }
 
+// If we can't tell, we assume there is one, since FindInDir returns an error
+// when there is more than one config file.
+func hasConfigFile(dir string) bool {
+	file, err := config.FindInDir(dir)
+	return file != "" || err != nil
+}
+
 func tidyCmd(getRootArgs func() (*alog.Logger, *config.Config)) func(*cli.Cmd) {
+	return filterCmd(getRootArgs, "Tidy", "", false, func(ctx context.Context, l *alog.Logger, c *config.Config, bf *basepaths.BasePaths, pa pathArgs) (filter.Outcome, error) {
+		tm, err := tidymaster.New(l, c, bf)
+		if err != nil {
+			return filter.Errored, err
+		}
+		if pa.stdin {
+			return tm.TidyStdin(ctx, pa.stdinFilename, readStdin(l), os.Stdout)
+		}
+		return tm.Tidy(ctx)
+	})
+}
+
+func lintCmd(getRootArgs func() (*alog.Logger, *config.Config)) func(*cli.Cmd) {
 	return func(cmd *cli.Cmd) {
-		mode, paths := sharedSubcommandArgs(cmd, "Tidy")
+		newIssuesOnly := cmd.BoolOpt(
+			"new-issues-only", false, "Only report issues on lines that were added or modified (use with -g, -s, or --base)")
+		margin := cmd.IntOpt(
+			"new-issues-context", 0, "With --new-issues-only, also report issues within this many lines of a change")
+
+		spec := "[--new-issues-only [--new-issues-context=<lines>]]"
+		filterCmd(getRootArgs, "Lint", spec, true, func(ctx context.Context, l *alog.Logger, c *config.Config, bf *basepaths.BasePaths, pa pathArgs) (filter.Outcome, error) {
+			lm, err := lintmaster.New(l, c, bf)
+			if err != nil {
+				return filter.Errored, err
+			}
+			if *newIssuesOnly {
+				if !bf.IsDiff() {
+					fatal(l, exitConfigError, "The --new-issues-only flag can only be used with the -g, -s, or --base flags")
+				}
+				if *margin < 0 {
+					fatal(l, exitConfigError, "The --new-issues-context flag cannot be negative")
+				}
+				lm.SetNewIssuesOnly(*margin)
+			}
+			if pa.stdin {
+				return lm.LintStdin(ctx, pa.stdinFilename, readStdin(l), os.Stdout)
+			}
+			return lm.Lint(ctx)
+		})(cmd)
+	}
+}
+
+type filterRunner func(context.Context, *alog.Logger, *config.Config, *basepaths.BasePaths, pathArgs) (filter.Outcome, error)
+
+func readStdin(l *alog.Logger) []byte {
+	content, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		fatal(l, exitInternalError, "%+v", errors.Wrap(err, "Could not read from stdin"))
+	}
+	return content
+}
+
+// The extraSpec is the spec for any options that the command defines itself.
+func filterCmd(getRootArgs func() (*alog.Logger, *config.Config), action, extraSpec string, prePush bool, run filterRunner) func(*cli.Cmd) {
+	return func(cmd *cli.Cmd) {
+		getSubcommandArgs := sharedSubcommandArgs(cmd, action, extraSpec, prePush)
 
 		cmd.Action = func() {
 			l, c := getRootArgs()
-			bf, err := basepaths.New(l, mode, paths, c.Exclude, c.Ignore)
+			pa, sel := getSubcommandArgs()
+
+			err := c.Select(sel)
+			if err != nil {
+				fatal(l, exitConfigError, "%+v", err)
+			}
+
+			typ := filter.Lint
+			if action == "Tidy" {
+				typ = filter.Tidy
+			}
+			// These messages tell the user what to install, so a stack trace
+			// would only get in the way.
+			err = c.CheckRequirements(typ)
+			if err != nil {
+				fatal(l, exitToolError, "%s", err)
+			}
+
+			bf, err := basepaths.New(l, pa.mode, c.Root(), c.Types(), pa.paths, c.Exclude, c.Ignore)
 			if err != nil {
-				fatal(l, "%+v", err)
+				fatal(l, exitConfigError, "%+v", err)
+			}
+			bf.SetRecurseSubmodules(pa.recurseSubmodules)
+			switch pa.mode {
+			case basepaths.GitBase:
+				bf.SetBase(pa.base, pa.includeWorktree)
+			case basepaths.FromFile:
+				bf.SetFilesFrom(pa.filesFrom, pa.nulSeparated)
 			}
+			// cli.Exit panics rather than exiting immediately, so this runs
+			// even when we exit early.
 			defer func() {
-				bf.UnstashIfNeeded()
+				err := bf.UnstashIfNeeded()
+				if err != nil {
+					l.Errorf("%+v", err)
+				}
 			}()
 
-			tidymaster, err := tidymaster.New(l, c, bf)
+			ctx, stop := cancelOnSignal(l)
+			defer stop()
+
+			outcome, err := run(ctx, l, c, bf, pa)
+			if ctx.Err() != nil {
+				cli.Exit(exitInterrupted)
+			}
 			if err != nil {
-				fatal(l, "%+v", err)
+				fatal(l, exitInternalError, "%+v", err)
+			}
+
+			switch outcome {
+			case filter.Failed:
+				cli.Exit(exitFindings)
+			case filter.Errored:
+				cli.Exit(exitToolError)
+			}
+		}
+	}
+}
+
+func doctorCmd(getRootArgs func() (*alog.Logger, *config.Config)) func(*cli.Cmd) {
+	return func(cmd *cli.Cmd) {
+		cmd.Action = func() {
+			l, c := getRootArgs()
+
+			checks := doctor.New(l, c).Run()
+			doctor.Print(os.Stdout, checks)
+			if doctor.Failed(checks) {
+				cli.Exit(exitFindings)
+			}
+		}
+	}
+}
+
+// Listing the types doesn't run any commands, so we don't need to check
+// whether the config is trusted.
+func typesCmd(getConfigFile func() (*alog.Logger, string)) func(*cli.Cmd) {
+	return func(cmd *cli.Cmd) {
+		cmd.Action = func() {
+			l, file := getConfigFile()
+			c := loadConfig(l, file)
+
+			for _, t := range c.Types().Types() {
+				fmt.Printf("%s: %s\n", t.Name, t.Describe())
 			}
+		}
+	}
+}
 
-			err = tidymaster.Tidy()
+func explainCmd(getConfig func() (*alog.Logger, *config.Config)) func(*cli.Cmd) {
+	return func(cmd *cli.Cmd) {
+		cmd.Spec = "PATHS..."
+		paths := cmd.StringsArg("PATHS", []string{}, "A list of paths to explain")
+
+		cmd.Action = func() {
+			l, c := getConfig()
+
+			bf, err := basepaths.New(l, basepaths.FromCLI, c.Root(), c.Types(), *paths, c.Exclude, c.Ignore)
 			if err != nil {
-				fatal(l, "%+v", err)
+				fatal(l, exitConfigError, "%+v", err)
+			}
+
+			for _, p := range *paths {
+				fmt.Println(p)
+
+				reason, err := bf.Explain(p)
+				if err != nil {
+					fatal(l, exitInternalError, "%+v", err)
+				}
+				if reason != "" {
+					fmt.Printf("  skipped by every filter because %s\n", reason)
+					continue
+				}
+
+				for _, f := range c.Filters() {
+					if reason := bf.ExplainFilter(p, f.Name()); reason != "" {
+						fmt.Printf("  %s: skipped because %s\n", f.Name(), reason)
+						continue
+					}
+
+					pf, err := pathfilter.New(f.Root, f.Types, f.Include, f.IncludeTypes, f.Exclude, f.Ignore, f.Skip)
+					if err != nil {
+						fatal(l, exitConfigError, "%+v", err)
+					}
+
+					reason, err := pf.Explain(p)
+					if err != nil {
+						fatal(l, exitInternalError, "%+v", err)
+					}
+					if reason != "" {
+						fmt.Printf("  %s: skipped because %s\n", f.Name(), reason)
+					} else {
+						fmt.Printf("  %s: %s\n", f.Name(), explainFilterType(f.Type))
+					}
+				}
 			}
 		}
 	}
 }
 
-func lintCmd(getRootArgs func() (*alog.Logger, *config.Config)) func(*cli.Cmd) {
+func explainFilterType(t filter.FilterType) string {
+	switch t {
+	case filter.Tidy:
+		return "included when tidying"
+	case filter.Lint:
+		return "included when linting"
+	}
+	return "included when tidying and linting"
+}
+
+func configCmd() func(*cli.Cmd) {
 	return func(cmd *cli.Cmd) {
+		cmd.Command("schema", "Prints a JSON Schema for the config file", func(cmd *cli.Cmd) {
+			cmd.Action = func() {
+				schema, err := config.JSONSchema()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%+v\n", err)
+					cli.Exit(exitConfigError)
+				}
+				os.Stdout.Write(schema)
+			}
+		})
 	}
 }
 
-func sharedSubcommandArgs(cmd *cli.Cmd, action string) (basepaths.Mode, []string) {
-	cmd.Spec = "[-a | -g | -s | PATHS]"
+func initCmd(getLogger func() *alog.Logger) func(*cli.Cmd) {
+	return func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f]"
+		force := cmd.BoolOpt("f force", false, "Overwrite an existing config file")
+
+		cmd.Action = func() {
+			l := getLogger()
+
+			root, found, err := checkoutRoot()
+			if err != nil {
+				fatal(l, exitInternalError, "%+v", err)
+			}
+			if !found {
+				root, err = os.Getwd()
+				if err != nil {
+					fatal(l, exitInternalError, "%+v", errors.Wrap(err, "Could not get your current working directory"))
+				}
+			}
+
+			existing, err := config.FindInDir(root)
+			if err != nil {
+				fatal(l, exitConfigError, "%+v", err)
+			}
+			if existing != "" && !*force {
+				fatal(l, exitConfigError, "There is already a config file at %s. Use --force to overwrite it.", existing)
+			}
+
+			tallies, err := scaffold.Scan(l, root)
+			if err != nil {
+				fatal(l, exitInternalError, "%+v", err)
+			}
+			content, err := scaffold.Config(tallies)
+			if err != nil {
+				fatal(l, exitConfigError, "%s", err)
+			}
+
+			file := filepath.Join(root, config.FileNames[0])
+			if existing != "" && existing != file {
+				err = os.Remove(existing)
+				if err != nil {
+					fatal(l, exitInternalError, "%+v", errors.Wrap(err, fmt.Sprintf("Could not remove %s", existing)))
+				}
+			}
+
+			err = ioutil.WriteFile(file, []byte(content), 0644)
+			if err != nil {
+				fatal(l, exitInternalError, "%+v", errors.Wrap(err, fmt.Sprintf("Could not write config to %s", file)))
+			}
+			l.Infof("Wrote a new config to %s", file)
+		}
+	}
+}
+
+// pathArgs are the flags and args that determine which paths are filtered.
+type pathArgs struct {
+	mode              basepaths.Mode
+	paths             []string
+	base              string
+	includeWorktree   bool
+	stdin             bool
+	stdinFilename     string
+	filesFrom         string
+	nulSeparated      bool
+	recurseSubmodules bool
+}
+
+// If prePush is true, the command also accepts the --pre-push flag.
+func sharedSubcommandArgs(cmd *cli.Cmd, action, extraSpec string, prePush bool) func() (pathArgs, config.Selection) {
+	modes := "-a | -g | -s | (--base=<ref> [--worktree]) | (--stdin --stdin-filename=<path>) | (--files-from=<file> [--null])"
+	if prePush {
+		modes += " | --pre-push"
+	}
+	cmd.Spec = "[--only=<name>]... [--skip=<name>]... [--tag=<tag>]... [--recurse-submodules] " + extraSpec + " [" + modes + " | PATHS...]"
+	only := cmd.StringsOpt(
+		"only", []string{}, fmt.Sprintf("Only %s with the named filter(s), comma-separated or repeated", strings.ToLower(action)))
+	skip := cmd.StringsOpt(
+		"skip", []string{}, "Skip the named filter(s), comma-separated or repeated")
+	tags := cmd.StringsOpt(
+		"tag", []string{}, "Only run filters with one of the given tags, comma-separated or repeated")
+	recurseSubmodules := cmd.BoolOpt(
+		"recurse-submodules", false, fmt.Sprintf("Also %s files in submodules, which are skipped by default", strings.ToLower(action)))
 	all := cmd.BoolOpt(
 		"a all", false, fmt.Sprintf("%s everything in the current directory and below", action))
 	git := cmd.BoolOpt(
-		"g git", false, fmt.Sprintf("%s files that have been modified according to git", action))
+		"g git", false, fmt.Sprintf("%s files that have been modified according to git, including untracked files", action))
 	staged := cmd.BoolOpt(
 		"s staged", false, fmt.Sprintf("%s file content that is staged for a git commit (use this for commit hooks)", action))
+	base := cmd.StringOpt(
+		"base", "", fmt.Sprintf(
+			"%s files changed since the merge base of HEAD and this ref, committed or staged. Use %q to detect the ref from the CI environment or origin's default branch",
+			action, basepaths.AutoBase))
+	worktree := cmd.BoolOpt(
+		"worktree", false, "With --base, also include unstaged changes and untracked files")
+	stdin := cmd.BoolOpt(
+		"stdin", false, fmt.Sprintf("%s content read from stdin instead of files on disk", action))
+	stdinFilename := cmd.StringOpt(
+		"stdin-filename", "", "With --stdin, the path the content belongs to, which is used to select filters and in their output")
+	filesFrom := cmd.StringOpt(
+		"files-from", "", fmt.Sprintf("Read the paths to %s from this file, one per line. Use --files-from=%s to read them from stdin", strings.ToLower(action), basepaths.StdinFile))
+	nulSeparated := cmd.BoolOpt(
+		"0 null", false, "With --files-from, the paths are separated by NUL bytes instead of newlines")
+	pushed := new(bool)
+	if prePush {
+		pushed = cmd.BoolOpt(
+			"pre-push", false, fmt.Sprintf("%s files changed in the commits being pushed, reading the refs from stdin (use this for pre-push hooks)", action))
+	}
 	paths := cmd.StringsArg("PATHS", []string{}, fmt.Sprintf("A list of paths to %s", strings.ToLower(action)))
 
-	switch {
-	case *all:
-		return basepaths.AllFiles, *paths
-	case *git:
-		return basepaths.GitModified, *paths
-	case *staged:
-		return basepaths.GitStaged, *paths
-	default:
-		return basepaths.FromCLI, *paths
+	return func() (pathArgs, config.Selection) {
+		sel := config.Selection{
+			Only: *only,
+			Skip: *skip,
+			Tags: *tags,
+		}
+
+		pa := pathArgs{paths: *paths, recurseSubmodules: *recurseSubmodules}
+		switch {
+		case *all:
+			pa.mode = basepaths.AllFiles
+		case *git:
+			pa.mode = basepaths.GitModified
+		case *staged:
+			pa.mode = basepaths.GitStaged
+		case *stdin:
+			pa.mode = basepaths.FromCLI
+			pa.stdin = true
+			pa.stdinFilename = *stdinFilename
+		case *filesFrom != "":
+			pa.mode = basepaths.FromFile
+			pa.filesFrom = *filesFrom
+			pa.nulSeparated = *nulSeparated
+		case *pushed:
+			pa.mode = basepaths.GitPrePush
+		case *base != "":
+			pa.mode = basepaths.GitBase
+			pa.base = *base
+			pa.includeWorktree = *worktree
+		default:
+			pa.mode = basepaths.FromCLI
+		}
+
+		return pa, sel
 	}
 }
 
-func loadConfig(l *alog.Logger, path string) *config.Config {
-	var configFile string
+func findConfigFile(l *alog.Logger, path string) string {
 	if path != "" {
-		configFile = path
-		l.Infof("Loading config from %s (set via flag)", configFile)
-	} else {
-		var err error
-		configFile, err = defaultConfigFile()
-		if err != nil {
-			fatal(l, fmt.Sprintf("%+v", err))
-		}
-		l.Infof("Loading config from %s (default location)", configFile)
+		l.Infof("Loading config from %s (set via flag)", path)
+		return path
 	}
 
-	c, err := config.NewFromFile(l, configFile)
+	file, err := defaultConfigFile(l)
 	if err != nil {
-		fatal(l, fmt.Sprintf("%+v", err))
+		fatal(l, exitConfigError, "%+v", err)
+	}
+
+	return file
+}
+
+func loadConfig(l *alog.Logger, configFile string) *config.Config {
+	root, err := rootDir(configFile)
+	if err != nil {
+		fatal(l, exitInternalError, "%+v", err)
+	}
+
+	c, err := config.NewFromFile(l, configFile, root)
+	if err != nil {
+		fatal(l, exitConfigError, "%+v", err)
 	}
 
 	return c
 }
 
-func fatal(l *alog.Logger, msg string, args ...interface{}) {
+func trustStore(l *alog.Logger) *trust.Store {
+	dir, err := userConfigDir()
+	if err != nil {
+		fatal(l, exitInternalError, "%+v", err)
+	}
+	return trust.NewStore(filepath.Join(dir, "trusted"))
+}
+
+// Since precious runs arbitrary commands from the config file, we require
+// the user to explicitly trust a config before running anything from it. A
+// config in the user's own config dir is always trusted.
+func checkTrust(l *alog.Logger, file string, trustFlag bool) {
+	if trustFlag {
+		l.Debugf("Not checking whether %s is trusted because --trust was passed", file)
+		return
+	}
+
+	dir, err := userConfigDir()
+	if err != nil {
+		fatal(l, exitInternalError, "%+v", err)
+	}
+	if abs, err := filepath.Abs(file); err == nil && filepath.Dir(abs) == dir {
+		return
+	}
+
+	status, diff, err := trustStore(l).Check(file)
+	if err != nil {
+		fatal(l, exitInternalError, "%+v", err)
+	}
+
+	switch status {
+	case trust.Unknown:
+		fatal(l, exitConfigError,
+			"The config file at %s has not been trusted. Since precious runs the commands in this file, please review it and then run \"precious trust\", or pass --trust to run it once.",
+			file)
+	case trust.Changed:
+		fatal(l, exitConfigError,
+			"The config file at %s has changed since you last trusted it:\n\n%s\nPlease review these changes and then run \"precious trust\", or pass --trust to run it once.",
+			file, diff)
+	}
+}
+
+func trustCmd(getConfigFile func() (*alog.Logger, string)) func(*cli.Cmd) {
+	return func(cmd *cli.Cmd) {
+		cmd.Action = func() {
+			l, file := getConfigFile()
+			store := trustStore(l)
+
+			status, diff, err := store.Check(file)
+			if err != nil {
+				fatal(l, exitInternalError, "%+v", err)
+			}
+
+			switch status {
+			case trust.Trusted:
+				l.Infof("The config file at %s is already trusted", file)
+				return
+			case trust.Changed:
+				l.Infof("Trusting these changes to %s since it was last trusted:\n\n%s", file, diff)
+			}
+
+			err = store.Trust(file)
+			if err != nil {
+				fatal(l, exitInternalError, "%+v", err)
+			}
+			l.Infof("The config file at %s is now trusted", file)
+		}
+	}
+}
+
+const profileEnvVar = "PRECIOUS_PROFILE"
+
+func useProfile(l *alog.Logger, c *config.Config, name string) {
+	if name != "" {
+		l.Infof("Using the %s profile (set via flag)", name)
+	} else if name = os.Getenv(profileEnvVar); name != "" {
+		l.Infof("Using the %s profile (set via $%s)", name, profileEnvVar)
+	} else {
+		l.Debug("Not using any config profile")
+		return
+	}
+
+	err := c.UseProfile(name)
+	if err != nil {
+		fatal(l, exitConfigError, "%+v", err)
+	}
+}
+
+// These let CI tell why precious failed. The mow.cli package exits with 2
+// when the command line arguments are invalid, so we don't use that.
+const (
+	// A filter found a problem with the code, or a doctor check failed.
+	exitFindings = 1
+	// The config file could not be found, could not be loaded, is not
+	// trusted, or asked for something that doesn't exist.
+	exitConfigError = 3
+	// A filter's command could not be found, could not be run, timed out, or
+	// exited with an unexpected code.
+	exitToolError = 4
+	// Anything else went wrong.
+	exitInternalError = 5
+	// This is the conventional exit code for a process that was stopped with
+	// SIGINT.
+	exitInterrupted = 130
+)
+
+// The returned context is cancelled when we get SIGINT or SIGTERM. The
+// filters are run in their own process groups, so they don't see a Ctrl-C in
+// the terminal. Instead, cancelling the context terminates them. A second
+// signal kills them without waiting for the grace period.
+func cancelOnSignal(l *alog.Logger) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	kill := make(chan struct{})
+	ctx = filter.WithKill(ctx, kill)
+	stopped := make(chan struct{})
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			l.Warnf("Got %s, stopping (send it again to kill running commands immediately)", sig)
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+
+		// The first signal gives running commands the grace period to exit.
+		// A second one means the user doesn't want to wait.
+		select {
+		case sig := <-sigs:
+			l.Warnf("Got %s again, killing running commands", sig)
+			close(kill)
+		case <-stopped:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigs)
+		close(stopped)
+		cancel()
+	}
+}
+
+func fatal(l *alog.Logger, code int, msg string, args ...interface{}) {
 	l.Errorf(msg, args...)
-	cli.Exit(1)
+	cli.Exit(code)
 }
 
-func defaultConfigFile() (string, error) {
-	root, err := rootDir()
+// We look for a config file in the current directory and each of its parents,
+// stopping at the checkout root. If none is found we fall back to a
+// user-level config.
+func defaultConfigFile(l *alog.Logger) (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", errors.Wrap(err, "Could not get your current working directory")
+	}
+
+	dir := wd
+	for {
+		file, err := config.FindInDir(dir)
+		if err != nil {
+			return "", err
+		}
+		if file != "" {
+			if dir == wd {
+				l.Infof("Loading config from %s (found in the current directory)", file)
+			} else {
+				l.Infof("Loading config from %s (found by searching up from %s)", file, wd)
+			}
+			return file, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if isCheckoutRoot(dir) || parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	userDir, err := userConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	file, err := config.FindInDir(userDir)
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(root, "precious.toml"), nil
+	if file != "" {
+		l.Infof("Loading config from %s (user-level config, no config was found between %s and %s)", file, wd, dir)
+		return file, nil
+	}
+
+	return "", errors.Errorf(
+		"Could not find a config file. Looked in %s and its parents up to %s, and in %s. The file can be named any of: %s",
+		wd, dir, userDir, strings.Join(config.FileNames, ", "))
 }
 
-func rootDir() (string, error) {
+func userConfigDir() (string, error) {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "precious"), nil
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", errors.Wrap(err, "Could not find your home directory")
+	}
+
+	return filepath.Join(home, ".config", "precious"), nil
+}
+
+// This returns the checkout root containing the current directory, if there
+// is one.
+func checkoutRoot() (string, bool, error) {
 	wd, err := os.Getwd()
-	return "", errors.Wrap(err, "Could not get your current working directory")
+	if err != nil {
+		return "", false, errors.Wrap(err, "Could not get your current working directory")
+	}
 
-	for wd != "/" {
+	for {
 		if isCheckoutRoot(wd) {
-			return wd, nil
+			return wd, true, nil
+		}
+		parent := filepath.Dir(wd)
+		if parent == wd {
+			return "", false, nil
 		}
-		wd = filepath.Dir(wd)
+		wd = parent
 	}
+}
 
-	home, err := homedir.Dir()
+// Outside of a checkout the root is the config file's dir if we are in or
+// below it. Otherwise the config is the user's own config, which applies
+// anywhere, so the root is the current directory.
+func rootDir(configFile string) (string, error) {
+	root, found, err := checkoutRoot()
 	if err != nil {
-		return "", errors.Wrap(err, "Could not find your home directory")
+		return "", err
+	}
+	if found {
+		return root, nil
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", errors.Wrap(err, "Could not get your current working directory")
+	}
+
+	configDir, err := filepath.Abs(filepath.Dir(configFile))
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("Could not get abs path for %s", configFile))
+	}
+	if _, ok := gitrepo.Relative(configDir, wd); ok {
+		return configDir, nil
 	}
 
-	return home, nil
+	return wd, nil
 }